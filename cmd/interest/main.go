@@ -0,0 +1,56 @@
+// Command interest accrues interest on every open account up to yesterday and
+// posts it at month end, printing what it did as JSON. With -dry-run nothing
+// is saved.
+package main
+
+import (
+	"encoding/json"
+	"example/database"
+	"example/handlers"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report what would be accrued and posted without saving it")
+	date := flag.String("date", "", "run as if it were this day (YYYY-MM-DD), defaults to today")
+	flag.Parse()
+
+	now := time.Now()
+	if *date != "" {
+		day, err := time.ParseInLocation(time.DateOnly, *date, time.Local)
+		if err != nil {
+			log.Fatal("Invalid -date:", err)
+		}
+		if day.After(now) && !*dryRun {
+			log.Fatal("A future -date needs -dry-run")
+		}
+		now = day
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Warning: Error loading .env file: %v", err)
+	}
+
+	db := database.ConnectDB()
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatal("Failed to get DB from GORM:", err)
+	}
+	defer sqlDB.Close()
+
+	report, err := handlers.RunInterest(db, now, *dryRun)
+	if err != nil {
+		log.Fatal("Interest run failed:", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatal(err)
+	}
+}
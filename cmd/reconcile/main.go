@@ -0,0 +1,46 @@
+// Command reconcile compares every account balance with the sum of its
+// transaction entries and prints the mismatches as JSON. With -fix it also
+// writes adjustment entries for them.
+package main
+
+import (
+	"encoding/json"
+	"example/database"
+	"example/handlers"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	fix := flag.Bool("fix", false, "write adjustment entries for every mismatch")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Warning: Error loading .env file: %v", err)
+	}
+
+	db := database.ConnectDB()
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatal("Failed to get DB from GORM:", err)
+	}
+	defer sqlDB.Close()
+
+	report, err := handlers.Reconcile(db, *fix)
+	if err != nil {
+		log.Fatal("Reconciliation failed:", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatal(err)
+	}
+
+	if len(report.Mismatches) > 0 && !*fix {
+		os.Exit(1)
+	}
+}
@@ -4,6 +4,9 @@ CREATE TABLE IF NOT EXISTS account
     account_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 0 MINVALUE 0 MAXVALUE 9223372036854775807 CACHE 1 ),
     name character varying COLLATE pg_catalog."default" NOT NULL,
     balance bigint NOT NULL,
+    currency character(3) COLLATE pg_catalog."default" NOT NULL DEFAULT 'IDR',
+    tier character varying COLLATE pg_catalog."default" NOT NULL DEFAULT 'basic',
+    status character varying COLLATE pg_catalog."default" NOT NULL DEFAULT 'active',
     referral_account_id bigint,
     CONSTRAINT account_pkey PRIMARY KEY (account_id),
     CONSTRAINT account_referral_account_id_fkey FOREIGN KEY (referral_account_id)
@@ -29,10 +32,17 @@ CREATE TABLE IF NOT EXISTS transaction
 (
     transaction_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
     transaction_category_id bigint,
+    kind character varying COLLATE pg_catalog."default" NOT NULL,
     account_id bigint NOT NULL,
     from_account_id bigint,
     to_account_id bigint,
+    pocket_id bigint,
     amount bigint NOT NULL,
+    currency character(3) COLLATE pg_catalog."default" NOT NULL DEFAULT 'IDR',
+    exchange_rate numeric(24, 10),
+    reference character varying COLLATE pg_catalog."default" NOT NULL,
+    reversal_of character varying COLLATE pg_catalog."default",
+    memo character varying COLLATE pg_catalog."default" NOT NULL DEFAULT '',
     transaction_date timestamp with time zone,
     CONSTRAINT transaction_pkey PRIMARY KEY (transaction_id),
     CONSTRAINT transaction_transaction_category_id_fkey FOREIGN KEY (transaction_category_id)
@@ -41,10 +51,486 @@ CREATE TABLE IF NOT EXISTS transaction
         ON DELETE NO ACTION
 )
 
+CREATE INDEX IF NOT EXISTS transaction_account_id_date_idx
+    ON transaction (account_id, transaction_date DESC, transaction_id DESC)
+
+CREATE INDEX IF NOT EXISTS transaction_reference_idx
+    ON transaction (reference)
+
+CREATE INDEX IF NOT EXISTS transaction_reversal_of_idx
+    ON transaction (reversal_of)
+
 -- Transaction_Category Table
 CREATE TABLE IF NOT EXISTS transaction_category
 (
     transaction_category_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    account_id bigint,
     name character varying COLLATE pg_catalog."default",
-    CONSTRAINT transaction_category_pkey PRIMARY KEY (transaction_category_id)
-)
\ No newline at end of file
+    archived boolean NOT NULL DEFAULT false,
+    CONSTRAINT transaction_category_pkey PRIMARY KEY (transaction_category_id),
+    CONSTRAINT transaction_category_account_id_fkey FOREIGN KEY (account_id)
+        REFERENCES account (account_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+
+CREATE UNIQUE INDEX IF NOT EXISTS transaction_category_system_name_idx
+    ON transaction_category (name) WHERE account_id IS NULL
+
+CREATE UNIQUE INDEX IF NOT EXISTS transaction_category_account_id_name_idx
+    ON transaction_category (account_id, name) WHERE account_id IS NOT NULL
+
+-- Idempotency_Key Table
+CREATE TABLE IF NOT EXISTS idempotency_key
+(
+    idempotency_key_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    key character varying COLLATE pg_catalog."default" NOT NULL,
+    scope character varying COLLATE pg_catalog."default" NOT NULL,
+    request_hash character varying COLLATE pg_catalog."default" NOT NULL,
+    status_code integer NOT NULL DEFAULT 0,
+    response_body text COLLATE pg_catalog."default",
+    created_at timestamp with time zone NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    CONSTRAINT idempotency_key_pkey PRIMARY KEY (idempotency_key_id),
+    CONSTRAINT idempotency_key_scope_key_key UNIQUE (scope, key)
+)
+
+-- Schedule Table
+CREATE TABLE IF NOT EXISTS schedule
+(
+    schedule_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    account_id bigint NOT NULL,
+    target_account_id bigint NOT NULL,
+    amount bigint NOT NULL,
+    interval_unit character varying COLLATE pg_catalog."default" NOT NULL,
+    interval_count integer NOT NULL DEFAULT 1,
+    start_at timestamp with time zone NOT NULL,
+    next_run_at timestamp with time zone NOT NULL,
+    end_date timestamp with time zone,
+    attempt integer NOT NULL DEFAULT 0,
+    retry_at timestamp with time zone,
+    status character varying COLLATE pg_catalog."default" NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    CONSTRAINT schedule_pkey PRIMARY KEY (schedule_id),
+    CONSTRAINT schedule_account_id_fkey FOREIGN KEY (account_id)
+        REFERENCES account (account_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION
+)
+
+CREATE INDEX IF NOT EXISTS schedule_status_next_run_at_idx
+    ON schedule (status, next_run_at)
+
+-- Schedule_Run Table
+CREATE TABLE IF NOT EXISTS schedule_run
+(
+    schedule_run_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    schedule_id bigint NOT NULL,
+    due_at timestamp with time zone NOT NULL,
+    run_at timestamp with time zone NOT NULL,
+    attempt integer NOT NULL,
+    status character varying COLLATE pg_catalog."default" NOT NULL,
+    error character varying COLLATE pg_catalog."default",
+    reference character varying COLLATE pg_catalog."default",
+    CONSTRAINT schedule_run_pkey PRIMARY KEY (schedule_run_id),
+    CONSTRAINT schedule_run_schedule_id_fkey FOREIGN KEY (schedule_id)
+        REFERENCES schedule (schedule_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+
+-- Exchange_Rate Table
+CREATE TABLE IF NOT EXISTS exchange_rate
+(
+    exchange_rate_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    base_currency character(3) COLLATE pg_catalog."default" NOT NULL,
+    quote_currency character(3) COLLATE pg_catalog."default" NOT NULL,
+    rate numeric(24, 10) NOT NULL,
+    updated_at timestamp with time zone NOT NULL,
+    CONSTRAINT exchange_rate_pkey PRIMARY KEY (exchange_rate_id),
+    CONSTRAINT exchange_rate_base_currency_quote_currency_key UNIQUE (base_currency, quote_currency)
+)
+
+-- Hold Table
+CREATE TABLE IF NOT EXISTS hold
+(
+    hold_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    account_id bigint NOT NULL,
+    merchant_account_id bigint NOT NULL,
+    amount bigint NOT NULL,
+    captured_amount bigint NOT NULL DEFAULT 0,
+    status character varying COLLATE pg_catalog."default" NOT NULL,
+    reference character varying COLLATE pg_catalog."default",
+    expires_at timestamp with time zone NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    CONSTRAINT hold_pkey PRIMARY KEY (hold_id),
+    CONSTRAINT hold_account_id_fkey FOREIGN KEY (account_id)
+        REFERENCES account (account_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION
+)
+
+CREATE INDEX IF NOT EXISTS hold_account_id_status_idx
+    ON hold (account_id, status)
+
+-- Limit_Tier Table
+CREATE TABLE IF NOT EXISTS limit_tier
+(
+    tier character varying COLLATE pg_catalog."default" NOT NULL,
+    operation character varying COLLATE pg_catalog."default" NOT NULL,
+    currency character(3) COLLATE pg_catalog."default" NOT NULL,
+    per_transaction_max bigint NOT NULL DEFAULT 0,
+    daily_total bigint NOT NULL DEFAULT 0,
+    monthly_total bigint NOT NULL DEFAULT 0,
+    daily_count bigint NOT NULL DEFAULT 0,
+    CONSTRAINT limit_tier_pkey PRIMARY KEY (tier, operation, currency)
+)
+
+INSERT INTO limit_tier (tier, operation, currency, per_transaction_max, daily_total, monthly_total, daily_count)
+VALUES
+    ('basic', 'transfer', 'IDR', 10000000, 25000000, 100000000, 50),
+    ('basic', 'topup', 'IDR', 10000000, 20000000, 100000000, 20)
+ON CONFLICT DO NOTHING
+
+-- Transfer_Batch Table
+CREATE TABLE IF NOT EXISTS transfer_batch
+(
+    transfer_batch_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    account_id bigint NOT NULL,
+    mode character varying COLLATE pg_catalog."default" NOT NULL,
+    status character varying COLLATE pg_catalog."default" NOT NULL,
+    total_amount bigint NOT NULL,
+    item_count integer NOT NULL,
+    succeeded_count integer NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    CONSTRAINT transfer_batch_pkey PRIMARY KEY (transfer_batch_id),
+    CONSTRAINT transfer_batch_account_id_fkey FOREIGN KEY (account_id)
+        REFERENCES account (account_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION
+)
+
+-- Transfer_Batch_Item Table
+CREATE TABLE IF NOT EXISTS transfer_batch_item
+(
+    transfer_batch_item_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    transfer_batch_id bigint NOT NULL,
+    line integer NOT NULL,
+    target_account_id bigint NOT NULL,
+    amount bigint NOT NULL,
+    status character varying COLLATE pg_catalog."default" NOT NULL,
+    error character varying COLLATE pg_catalog."default",
+    reference character varying COLLATE pg_catalog."default",
+    CONSTRAINT transfer_batch_item_pkey PRIMARY KEY (transfer_batch_item_id),
+    CONSTRAINT transfer_batch_item_transfer_batch_id_fkey FOREIGN KEY (transfer_batch_id)
+        REFERENCES transfer_batch (transfer_batch_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+
+-- Category_Rule Table
+CREATE TABLE IF NOT EXISTS category_rule
+(
+    category_rule_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    account_id bigint NOT NULL,
+    transaction_category_id bigint NOT NULL,
+    counterparty_account_id bigint,
+    min_amount bigint,
+    max_amount bigint,
+    memo_contains character varying COLLATE pg_catalog."default",
+    day_of_week integer,
+    priority integer NOT NULL DEFAULT 0,
+    created_at timestamp with time zone NOT NULL,
+    CONSTRAINT category_rule_pkey PRIMARY KEY (category_rule_id),
+    CONSTRAINT category_rule_account_id_fkey FOREIGN KEY (account_id)
+        REFERENCES account (account_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT category_rule_transaction_category_id_fkey FOREIGN KEY (transaction_category_id)
+        REFERENCES transaction_category (transaction_category_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+
+-- Budget Table
+CREATE TABLE IF NOT EXISTS budget
+(
+    budget_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    account_id bigint NOT NULL,
+    transaction_category_id bigint NOT NULL,
+    amount bigint NOT NULL,
+    period character varying COLLATE pg_catalog."default" NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    CONSTRAINT budget_pkey PRIMARY KEY (budget_id),
+    CONSTRAINT budget_account_id_transaction_category_id_key UNIQUE (account_id, transaction_category_id),
+    CONSTRAINT budget_account_id_fkey FOREIGN KEY (account_id)
+        REFERENCES account (account_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT budget_transaction_category_id_fkey FOREIGN KEY (transaction_category_id)
+        REFERENCES transaction_category (transaction_category_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+
+-- Budget_Alert Table
+CREATE TABLE IF NOT EXISTS budget_alert
+(
+    budget_alert_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    budget_id bigint NOT NULL,
+    account_id bigint NOT NULL,
+    period_start timestamp with time zone NOT NULL,
+    threshold integer NOT NULL,
+    spent bigint NOT NULL,
+    reference character varying COLLATE pg_catalog."default" NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    CONSTRAINT budget_alert_pkey PRIMARY KEY (budget_alert_id),
+    CONSTRAINT budget_alert_budget_id_period_start_threshold_key UNIQUE (budget_id, period_start, threshold),
+    CONSTRAINT budget_alert_budget_id_fkey FOREIGN KEY (budget_id)
+        REFERENCES budget (budget_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+
+-- Account_Status_Change Table
+CREATE TABLE IF NOT EXISTS account_status_change
+(
+    account_status_change_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    account_id bigint NOT NULL,
+    from_status character varying COLLATE pg_catalog."default" NOT NULL,
+    to_status character varying COLLATE pg_catalog."default" NOT NULL,
+    reason character varying COLLATE pg_catalog."default" NOT NULL,
+    changed_by character varying COLLATE pg_catalog."default" NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    CONSTRAINT account_status_change_pkey PRIMARY KEY (account_status_change_id),
+    CONSTRAINT account_status_change_account_id_fkey FOREIGN KEY (account_id)
+        REFERENCES account (account_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+
+-- Account_Member Table
+CREATE TABLE IF NOT EXISTS account_member
+(
+    account_id bigint NOT NULL,
+    auth_id bigint NOT NULL,
+    role character varying COLLATE pg_catalog."default" NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    CONSTRAINT account_member_pkey PRIMARY KEY (account_id, auth_id),
+    CONSTRAINT account_member_account_id_fkey FOREIGN KEY (account_id)
+        REFERENCES account (account_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT account_member_auth_id_fkey FOREIGN KEY (auth_id)
+        REFERENCES auth (auth_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+
+CREATE INDEX IF NOT EXISTS account_member_auth_id_idx
+    ON account_member (auth_id)
+
+-- every existing user owns the account their login points at
+INSERT INTO account_member (account_id, auth_id, role, created_at)
+SELECT auth.account_id, auth.auth_id, 'owner', now()
+FROM auth
+JOIN account ON account.account_id = auth.account_id
+ON CONFLICT DO NOTHING
+
+-- Account_Invitation Table
+CREATE TABLE IF NOT EXISTS account_invitation
+(
+    account_invitation_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    account_id bigint NOT NULL,
+    auth_id bigint NOT NULL,
+    role character varying COLLATE pg_catalog."default" NOT NULL,
+    invited_by bigint NOT NULL,
+    status character varying COLLATE pg_catalog."default" NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    responded_at timestamp with time zone,
+    CONSTRAINT account_invitation_pkey PRIMARY KEY (account_invitation_id),
+    CONSTRAINT account_invitation_account_id_fkey FOREIGN KEY (account_id)
+        REFERENCES account (account_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT account_invitation_auth_id_fkey FOREIGN KEY (auth_id)
+        REFERENCES auth (auth_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+
+CREATE UNIQUE INDEX IF NOT EXISTS account_invitation_pending_idx
+    ON account_invitation (account_id, auth_id) WHERE status = 'pending'
+
+-- Pocket Table
+CREATE TABLE IF NOT EXISTS pocket
+(
+    pocket_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    account_id bigint NOT NULL,
+    name character varying COLLATE pg_catalog."default" NOT NULL,
+    balance bigint NOT NULL DEFAULT 0,
+    created_at timestamp with time zone NOT NULL,
+    CONSTRAINT pocket_pkey PRIMARY KEY (pocket_id),
+    CONSTRAINT pocket_account_id_name_key UNIQUE (account_id, name),
+    CONSTRAINT pocket_account_id_fkey FOREIGN KEY (account_id)
+        REFERENCES account (account_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+
+-- Interest_Tier Table
+CREATE TABLE IF NOT EXISTS interest_tier
+(
+    currency character(3) COLLATE pg_catalog."default" NOT NULL,
+    min_balance bigint NOT NULL,
+    annual_rate numeric(12, 8) NOT NULL,
+    CONSTRAINT interest_tier_pkey PRIMARY KEY (currency, min_balance)
+)
+
+INSERT INTO interest_tier (currency, min_balance, annual_rate)
+VALUES
+    ('IDR', 0, 0.005),
+    ('IDR', 10000000, 0.02),
+    ('IDR', 100000000, 0.03)
+ON CONFLICT DO NOTHING
+
+-- Interest_Accrual Table
+CREATE TABLE IF NOT EXISTS interest_accrual
+(
+    account_id bigint NOT NULL,
+    accrued character varying COLLATE pg_catalog."default" NOT NULL DEFAULT '0',
+    accrued_through date NOT NULL,
+    updated_at timestamp with time zone NOT NULL,
+    CONSTRAINT interest_accrual_pkey PRIMARY KEY (account_id),
+    CONSTRAINT interest_accrual_account_id_fkey FOREIGN KEY (account_id)
+        REFERENCES account (account_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+
+-- Fee_Rule Table
+CREATE TABLE IF NOT EXISTS fee_rule
+(
+    operation character varying COLLATE pg_catalog."default" NOT NULL,
+    currency character(3) COLLATE pg_catalog."default" NOT NULL,
+    min_amount bigint NOT NULL,
+    flat bigint NOT NULL DEFAULT 0,
+    percent numeric(12, 8) NOT NULL DEFAULT 0,
+    min_fee bigint NOT NULL DEFAULT 0,
+    max_fee bigint NOT NULL DEFAULT 0,
+    free_per_month bigint NOT NULL DEFAULT 0,
+    CONSTRAINT fee_rule_pkey PRIMARY KEY (operation, currency, min_amount)
+)
+
+INSERT INTO fee_rule (operation, currency, min_amount, flat, percent, min_fee, max_fee, free_per_month)
+VALUES
+    ('transfer', 'IDR', 0, 2500, 0, 0, 0, 5),
+    ('transfer', 'IDR', 100000000, 0, 0.001, 5000, 25000, 0)
+ON CONFLICT DO NOTHING
+
+-- Fee_Charge Table
+CREATE TABLE IF NOT EXISTS fee_charge
+(
+    fee_charge_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    account_id bigint NOT NULL,
+    operation character varying COLLATE pg_catalog."default" NOT NULL,
+    reference character varying COLLATE pg_catalog."default" NOT NULL,
+    amount bigint NOT NULL,
+    fee bigint NOT NULL,
+    free boolean NOT NULL DEFAULT false,
+    fee_reference character varying COLLATE pg_catalog."default",
+    created_at timestamp with time zone NOT NULL,
+    CONSTRAINT fee_charge_pkey PRIMARY KEY (fee_charge_id),
+    CONSTRAINT fee_charge_account_id_fkey FOREIGN KEY (account_id)
+        REFERENCES account (account_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+
+-- Payment_Request Table
+CREATE TABLE IF NOT EXISTS payment_request
+(
+    payment_request_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    requester_account_id bigint NOT NULL,
+    payer_account_id bigint NOT NULL,
+    amount bigint NOT NULL,
+    currency character(3) COLLATE pg_catalog."default" NOT NULL,
+    note character varying COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    status character varying COLLATE pg_catalog."default" NOT NULL,
+    reference character varying COLLATE pg_catalog."default",
+    requested_by bigint NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    responded_at timestamp with time zone,
+    created_at timestamp with time zone NOT NULL,
+    CONSTRAINT payment_request_pkey PRIMARY KEY (payment_request_id),
+    CONSTRAINT payment_request_requester_account_id_fkey FOREIGN KEY (requester_account_id)
+        REFERENCES account (account_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT payment_request_payer_account_id_fkey FOREIGN KEY (payer_account_id)
+        REFERENCES account (account_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+
+CREATE INDEX IF NOT EXISTS payment_request_status_expires_at_idx
+    ON payment_request (status, expires_at)
+
+-- Bill_Split Table
+CREATE TABLE IF NOT EXISTS bill_split
+(
+    bill_split_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    account_id bigint NOT NULL,
+    total bigint NOT NULL,
+    currency character(3) COLLATE pg_catalog."default" NOT NULL,
+    mode character varying COLLATE pg_catalog."default" NOT NULL,
+    note character varying COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    created_by bigint NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    CONSTRAINT bill_split_pkey PRIMARY KEY (bill_split_id),
+    CONSTRAINT bill_split_account_id_fkey FOREIGN KEY (account_id)
+        REFERENCES account (account_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+
+-- Bill_Split_Share Table
+CREATE TABLE IF NOT EXISTS bill_split_share
+(
+    bill_split_share_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    bill_split_id bigint NOT NULL,
+    account_id bigint NOT NULL,
+    amount bigint NOT NULL,
+    payment_request_id bigint,
+    CONSTRAINT bill_split_share_pkey PRIMARY KEY (bill_split_share_id),
+    CONSTRAINT bill_split_share_bill_split_id_account_id_key UNIQUE (bill_split_id, account_id),
+    CONSTRAINT bill_split_share_bill_split_id_fkey FOREIGN KEY (bill_split_id)
+        REFERENCES bill_split (bill_split_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT bill_split_share_payment_request_id_fkey FOREIGN KEY (payment_request_id)
+        REFERENCES payment_request (payment_request_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+
+-- QRIS_Payment Table
+CREATE TABLE IF NOT EXISTS qris_payment
+(
+    qris_payment_id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    account_id bigint NOT NULL,
+    code_reference character varying COLLATE pg_catalog."default" NOT NULL,
+    payer_account_id bigint NOT NULL,
+    reference character varying COLLATE pg_catalog."default" NOT NULL,
+    paid_at timestamp with time zone NOT NULL,
+    CONSTRAINT qris_payment_pkey PRIMARY KEY (qris_payment_id),
+    CONSTRAINT qris_payment_account_id_code_reference_key UNIQUE (account_id, code_reference),
+    CONSTRAINT qris_payment_account_id_fkey FOREIGN KEY (account_id)
+        REFERENCES account (account_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT qris_payment_payer_account_id_fkey FOREIGN KEY (payer_account_id)
+        REFERENCES account (account_id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
@@ -2,7 +2,11 @@ package handlers
 
 import (
 	"example/model"
+	"example/utils"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -18,23 +22,37 @@ type AccountInterface interface {
 	TopUp(*gin.Context)
 	Balance(*gin.Context)
 	Transfer(*gin.Context)
+	Withdraw(*gin.Context)
+	Limits(*gin.Context)
+	Statement(*gin.Context)
+	Analytics(*gin.Context)
+	SetStatus(*gin.Context)
+	StatusHistory(*gin.Context)
 }
 
 type accountImplement struct {
-	db *gorm.DB
+	db        *gorm.DB
+	analytics *analyticsCache
 }
 
 func NewAccount(db *gorm.DB) AccountInterface {
 	return &accountImplement{
-		db: db,
+		db:        db,
+		analytics: newAnalyticsCache(),
 	}
 }
 
+type withdrawPayload struct {
+	Amount int64 `json:"amount" binding:"required,gt=0"`
+}
+
 type transferPayload struct {
-	TargetID int64 `json:"target_account_id" binding:"required"`
-	Amount   int64 `json:"balance" binding:"required"`
+	TargetID int64  `json:"target_account_id" binding:"required"`
+	Amount   int64  `json:"balance" binding:"required,gt=0"`
+	Memo     string `json:"memo" binding:"max=140"`
 }
 
+// Create opens an account with the caller as its owner.
 func (a *accountImplement) Create(ctx *gin.Context) {
 	payload := model.Account{}
 
@@ -47,15 +65,61 @@ func (a *accountImplement) Create(ctx *gin.Context) {
 		return
 	}
 
+	// Accounts open empty; money only comes in through the ledger so the
+	// balance always matches the journal
+	payload.Balance = 0
+
+	// Accounts are opened in rupiah unless another currency is given
+	payload.Currency = strings.ToUpper(payload.Currency)
+	if payload.Currency == "" {
+		payload.Currency = "IDR"
+	}
+	if !utils.CurrencySupported(payload.Currency) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Unsupported currency",
+		})
+		return
+	}
+
+	tx := a.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
 	// Create data
-	result := a.db.Create(&payload)
+	result := tx.Create(&payload)
 	if result.Error != nil {
+		tx.Rollback()
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error": result.Error.Error(),
 		})
 		return
 	}
 
+	member := model.AccountMember{
+		AccountID: payload.AccountID,
+		AuthID:    ctx.GetInt64("auth_id"),
+		Role:      model.RoleOwner,
+		CreatedAt: time.Now(),
+	}
+	if err := tx.Create(&member).Error; err != nil {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	// Success response
 	ctx.JSON(http.StatusOK, gin.H{
 		"message": "Create success",
@@ -68,6 +132,12 @@ func (a *accountImplement) Read(ctx *gin.Context) {
 
 	// get id from url account/read/5, 5 will be the id
 	id := ctx.Param("id")
+	if id != strconv.FormatInt(ctx.GetInt64("account_id"), 10) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Not a member of this account",
+		})
+		return
+	}
 
 	// Find first data based on id and put to account model
 	if err := a.db.First(&account, id).Error; err != nil {
@@ -104,6 +174,12 @@ func (a *accountImplement) Update(ctx *gin.Context) {
 
 	// get id from url account/update/5, 5 will be the id
 	id := ctx.Param("id")
+	if id != strconv.FormatInt(ctx.GetInt64("account_id"), 10) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Only an owner can update the account",
+		})
+		return
+	}
 
 	// Find first data based on id and put to account model
 	account := model.Account{}
@@ -121,9 +197,14 @@ func (a *accountImplement) Update(ctx *gin.Context) {
 		return
 	}
 
-	// Update data
-	account.Name = payload.Name
-	a.db.Save(account)
+	// Update only the name, saving the whole row would write back a balance
+	// read before any concurrent transfer
+	if err := a.db.Model(&account).Update("name", payload.Name).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
 	// Success response
 	ctx.JSON(http.StatusOK, gin.H{
@@ -131,32 +212,23 @@ func (a *accountImplement) Update(ctx *gin.Context) {
 	})
 }
 
+// Delete closes an account the caller owns. Accounts are never removed, so
+// their ledger stays intact, and only an account with a zero balance can be
+// closed.
 func (a *accountImplement) Delete(ctx *gin.Context) {
 	// get id from url account/delete/5, 5 will be the id
 	id := ctx.Param("id")
+	accountID := ctx.GetInt64("account_id")
 
-	// Find first data based on id and delete it
-	if err := a.db.Where("account_id = ?", id).Delete(&model.Account{}).Error; err != nil {
-		// No data found and deleted
-		if err == gorm.ErrRecordNotFound {
-			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
-				"error": "Not found",
-			})
-			return
-		}
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
+	if id != strconv.FormatInt(accountID, 10) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Only an owner can close the account",
 		})
 		return
 	}
 
-	// Success response
-	ctx.JSON(http.StatusOK, gin.H{
-		"message": "Delete success",
-		"data": map[string]string{
-			"account_id": id,
-		},
-	})
+	reason := ctx.DefaultQuery("reason", "Closed by owner")
+	a.runStatusChange(ctx, accountID, accountClosed, reason, ctx.GetString("username"))
 }
 
 func (a *accountImplement) List(ctx *gin.Context) {
@@ -206,21 +278,23 @@ func (a *accountImplement) My(ctx *gin.Context) {
 func (a *accountImplement) TopUp(ctx *gin.Context) {
 	payload := model.Account{}
 	if err := ctx.ShouldBindJSON(&payload); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
 		})
-
+		return
 	}
 
-	account := model.Account{}
-	id := ctx.Param("id")
-	if result := a.db.First(&account, "account_id=?", id); result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
-				"error": result.Error.Error(),
-			})
-			return
-		}
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid account id",
+		})
+		return
+	}
+	if id != ctx.GetInt64("account_id") {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Only an owner can top up the account",
+		})
 		return
 	}
 
@@ -231,12 +305,12 @@ func (a *accountImplement) TopUp(ctx *gin.Context) {
 		}
 	}()
 
-	account.Balance += payload.Balance
-	if err := tx.Save(&account).Error; err != nil {
+	// lock the account row and add the balance in a single statement so
+	// concurrent top-ups cannot overwrite each other
+	account, reference, fee, err := creditFunds(tx, categoryTopUp, id, payload.Balance)
+	if err != nil {
 		tx.Rollback()
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+		abortWithLedgerError(ctx, err)
 		return
 	}
 
@@ -249,8 +323,10 @@ func (a *accountImplement) TopUp(ctx *gin.Context) {
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{
-		"message": "Update success",
-		"balance": account.Balance,
+		"message":   "Update success",
+		"balance":   account.Balance,
+		"reference": reference,
+		"fee":       fee,
 	})
 }
 
@@ -272,15 +348,41 @@ func (a *accountImplement) Balance(ctx *gin.Context) {
 		return
 	}
 
+	// the ledger balance still includes money reserved by holds and set
+	// aside in pockets, the available balance is what can be spent right now
+	held, err := heldAmount(a.db, account.AccountID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	pockets, err := accountPockets(a.db, account.AccountID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var pocketed int64
+	for _, pocket := range pockets {
+		pocketed += pocket.Balance
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
-		"message": "success",
-		"balance": account.Balance,
+		"message":           "success",
+		"balance":           account.Balance,
+		"main_balance":      account.Balance - pocketed,
+		"available_balance": account.Balance - held - pocketed,
+		"currency":          account.Currency,
+		"pockets":           pockets,
 	})
 }
 
 func (a *accountImplement) Transfer(ctx *gin.Context) {
 	payload := transferPayload{}
-	var senderAccount, recepientAccount model.Account
 	accountID := ctx.GetInt64("account_id")
 
 	if err := ctx.ShouldBindJSON(&payload); err != nil {
@@ -290,26 +392,51 @@ func (a *accountImplement) Transfer(ctx *gin.Context) {
 		return
 	}
 
-	accounts := []model.Account{senderAccount, recepientAccount}
-	if err := a.db.Where("account_id IN (?)", []int64{accountID, payload.TargetID}).Find(&accounts).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
-				"error": "Data not found",
-			})
-			return
+	tx := a.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
 		}
-		ctx.JSON(http.StatusBadRequest, gin.H{
+	}()
+
+	// both rows are locked FOR UPDATE before the balance check, so the check
+	// and the update can't be interleaved with another transfer
+	result, err := transferFunds(tx, categoryTransfer, accountID, payload.TargetID, payload.Amount, payload.Memo)
+	if err != nil {
+		tx.Rollback()
+		abortWithLedgerError(ctx, err)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
 
-	senderAccount = accounts[0]
-	recepientAccount = accounts[1]
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":           "Update success",
+		"amount":            payload.Amount,
+		"credited_amount":   result.CreditedAmount,
+		"exchange_rate":     result.ExchangeRate,
+		"sender_balance":    result.Sender.Balance,
+		"recepient_balance": result.Recipient.Balance,
+		"reference":         result.Reference,
+		"fee":               result.Fee,
+	})
+}
+
+// Withdraw takes money out of the caller's account. The returned reference
+// identifies the withdrawal for support.
+func (a *accountImplement) Withdraw(ctx *gin.Context) {
+	payload := withdrawPayload{}
+	accountID := ctx.GetInt64("account_id")
 
-	if senderAccount.Balance < payload.Amount {
-		ctx.AbortWithStatusJSON(http.StatusNotAcceptable, gin.H{
-			"error": "Balance not enough",
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
 		})
 		return
 	}
@@ -321,17 +448,14 @@ func (a *accountImplement) Transfer(ctx *gin.Context) {
 		}
 	}()
 
-	senderAccount.Balance -= payload.Amount
-	if err := tx.Save(&senderAccount).Error; err != nil {
+	account, reference, err := debitFunds(tx, categoryWithdrawal, accountID, payload.Amount)
+	if err != nil {
 		tx.Rollback()
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+		abortWithLedgerError(ctx, err)
 		return
 	}
 
-	recepientAccount.Balance += payload.Amount
-	if err := tx.Save(&recepientAccount).Error; err != nil {
+	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -339,18 +463,64 @@ func (a *accountImplement) Transfer(ctx *gin.Context) {
 		return
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		ctx.JSON(http.StatusInternalServerError, gin.H{
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":   "Withdraw success",
+		"amount":    payload.Amount,
+		"balance":   account.Balance,
+		"reference": reference,
+	})
+}
+
+// Limits shows the caller's transfer and top-up limits and how much of each
+// is left for the current day and month.
+func (a *accountImplement) Limits(ctx *gin.Context) {
+	var account model.Account
+	accountID := ctx.GetInt64("account_id")
+
+	if err := a.db.First(&account, accountID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Data not found",
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
 
+	now := time.Now()
+	limits := gin.H{}
+	for _, operation := range []string{limitTransfer, limitTopUp} {
+		limit, err := accountLimit(a.db, &account, operation)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		used, err := usage(a.db, account.AccountID, operation, now)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		limits[operation] = gin.H{
+			"per_transaction_max": limit.PerTransactionMax,
+			"daily_total":         newLimitRemaining(limit.DailyTotal, used.DailyTotal),
+			"monthly_total":       newLimitRemaining(limit.MonthlyTotal, used.MonthlyTotal),
+			"daily_count":         newLimitRemaining(limit.DailyCount, used.DailyCount),
+		}
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
-		"message":           "Update success",
-		"amount":            payload.Amount,
-		"sender_balance":    senderAccount.Balance,
-		"recepient_balance": recepientAccount.Balance,
+		"message": "success",
+		"tier":    account.Tier,
+		"limits":  limits,
 	})
 }
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// analyticsCacheTTL is how long a computed report is served before it is
+// recomputed, so new transactions show up after at most this long.
+const analyticsCacheTTL = 5 * time.Minute
+
+const (
+	analyticsDefaultTop = 5
+	analyticsMaxTop     = 50
+)
+
+type analyticsBucket struct {
+	Period  time.Time `json:"period"`
+	Income  int64     `json:"income"`
+	Expense int64     `json:"expense"`
+}
+
+type analyticsCategory struct {
+	TransactionCategoryID int64  `json:"transaction_category_id"`
+	Name                  string `json:"name"`
+	Income                int64  `json:"income"`
+	Expense               int64  `json:"expense"`
+}
+
+type analyticsCounterparty struct {
+	AccountID int64  `json:"account_id"`
+	Name      string `json:"name"`
+	Income    int64  `json:"income"`
+	Expense   int64  `json:"expense"`
+	Count     int64  `json:"count"`
+}
+
+type analyticsReport struct {
+	From           time.Time               `json:"from"`
+	To             time.Time               `json:"to"`
+	Group          string                  `json:"group"`
+	Income         int64                   `json:"income"`
+	Expense        int64                   `json:"expense"`
+	Periods        []analyticsBucket       `json:"periods"`
+	Categories     []analyticsCategory     `json:"categories"`
+	Counterparties []analyticsCounterparty `json:"counterparties"`
+}
+
+type analyticsEntry struct {
+	report  *analyticsReport
+	expires time.Time
+}
+
+// analyticsCache keeps computed reports per account and requested period.
+type analyticsCache struct {
+	mu      sync.Mutex
+	entries map[string]analyticsEntry
+}
+
+func newAnalyticsCache() *analyticsCache {
+	return &analyticsCache{
+		entries: map[string]analyticsEntry{},
+	}
+}
+
+func (c *analyticsCache) get(key string, now time.Time) (*analyticsReport, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || now.After(entry.expires) {
+		return nil, false
+	}
+	return entry.report, true
+}
+
+// set stores a report and drops the expired ones, so accounts that stop
+// asking don't keep their reports around.
+func (c *analyticsCache) set(key string, report *analyticsReport, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = analyticsEntry{report: report, expires: now.Add(analyticsCacheTTL)}
+}
+
+// buildAnalytics aggregates the account's entries between from and to.
+// Credits count as income and debits as expense.
+func buildAnalytics(db *gorm.DB, accountID int64, group string, from, to time.Time, top int) (*analyticsReport, error) {
+	report := analyticsReport{
+		From:           from,
+		To:             to,
+		Group:          group,
+		Periods:        []analyticsBucket{},
+		Categories:     []analyticsCategory{},
+		Counterparties: []analyticsCounterparty{},
+	}
+
+	// a new session per query, so the three aggregates share the filter
+	// without adding to each other's clauses. Moves between the account's
+	// own pockets are neither income nor expense.
+	entries := db.Table("transaction").
+		Where("transaction.account_id = ? AND transaction.transaction_date >= ? AND transaction.transaction_date < ?", accountID, from, to).
+		Where("transaction.from_account_id IS DISTINCT FROM transaction.to_account_id").
+		Session(&gorm.Session{})
+
+	if err := entries.
+		Select("date_trunc(?, transaction.transaction_date) AS period, "+
+			"COALESCE(SUM(transaction.amount) FILTER (WHERE transaction.amount > 0), 0) AS income, "+
+			"COALESCE(-SUM(transaction.amount) FILTER (WHERE transaction.amount < 0), 0) AS expense", group).
+		Group("period").
+		Order("period").
+		Scan(&report.Periods).Error; err != nil {
+		return nil, err
+	}
+
+	for _, bucket := range report.Periods {
+		report.Income += bucket.Income
+		report.Expense += bucket.Expense
+	}
+
+	if err := entries.
+		Joins("JOIN transaction_category ON transaction_category.transaction_category_id = transaction.transaction_category_id").
+		Select("transaction.transaction_category_id, transaction_category.name, " +
+			"COALESCE(SUM(transaction.amount) FILTER (WHERE transaction.amount > 0), 0) AS income, " +
+			"COALESCE(-SUM(transaction.amount) FILTER (WHERE transaction.amount < 0), 0) AS expense").
+		Group("transaction.transaction_category_id, transaction_category.name").
+		Order("expense DESC, income DESC").
+		Scan(&report.Categories).Error; err != nil {
+		return nil, err
+	}
+
+	// the counterparty is the recipient of a debit or the sender of a credit,
+	// entries with the outside world have none
+	if err := entries.
+		Joins("JOIN account ON account.account_id = CASE WHEN transaction.amount < 0 THEN transaction.to_account_id ELSE transaction.from_account_id END").
+		Select("account.account_id, account.name, "+
+			"COALESCE(SUM(transaction.amount) FILTER (WHERE transaction.amount > 0), 0) AS income, "+
+			"COALESCE(-SUM(transaction.amount) FILTER (WHERE transaction.amount < 0), 0) AS expense, "+
+			"COUNT(*) AS count").
+		Where("account.account_id <> ?", accountID).
+		Group("account.account_id, account.name").
+		Order("SUM(ABS(transaction.amount)) DESC, account.account_id").
+		Limit(top).
+		Scan(&report.Counterparties).Error; err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// Analytics returns the caller's income and expense between from and to,
+// per day, week or month, per category and for the top counterparties.
+// Reports are cached for analyticsCacheTTL.
+func (a *accountImplement) Analytics(ctx *gin.Context) {
+	accountID := ctx.GetInt64("account_id")
+
+	group := ctx.DefaultQuery("group", "day")
+	if group != "day" && group != "week" && group != "month" {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "group must be day, week or month",
+		})
+		return
+	}
+
+	// the default window ends with today rather than now, so repeated
+	// requests share a cache entry
+	now := time.Now()
+	from, to := startOfMonth(now), startOfDay(now).AddDate(0, 0, 1)
+	if value := ctx.Query("from"); value != "" {
+		parsed, err := parseHistoryTime(value)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid from",
+			})
+			return
+		}
+		from = parsed
+	}
+	if value := ctx.Query("to"); value != "" {
+		parsed, err := parseHistoryEnd(value)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid to",
+			})
+			return
+		}
+		to = parsed
+	}
+	if !from.Before(to) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "from must be before to",
+		})
+		return
+	}
+
+	top := analyticsDefaultTop
+	if value := ctx.Query("top"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid top",
+			})
+			return
+		}
+		top = min(parsed, analyticsMaxTop)
+	}
+
+	key := fmt.Sprintf("%d:%s:%d:%d:%d", accountID, group, from.UnixNano(), to.UnixNano(), top)
+	report, ok := a.analytics.get(key, now)
+	if !ok {
+		var err error
+		if report, err = buildAnalytics(a.db, accountID, group, from, to, top); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		a.analytics.set(key, report, now)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    report,
+	})
+}
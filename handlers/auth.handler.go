@@ -36,12 +36,30 @@ type authPayload struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// defaultAccount returns the account a login acts on when a request doesn't
+// pick one with X-Account-ID: the first account it owns, otherwise the first
+// it is a member of, or 0 without any membership.
+func defaultAccount(db *gorm.DB, authID int64) (int64, error) {
+	member := model.AccountMember{}
+	err := db.Where("auth_id = ?", authID).
+		Order("role = '" + model.RoleOwner + "' DESC, account_id").
+		Limit(1).
+		Find(&member).Error
+
+	return member.AccountID, err
+}
+
 func (a *authImplement) createJWT(auth *model.Auth) (string, error) {
+	accountID, err := defaultAccount(a.db, auth.AuthID)
+	if err != nil {
+		return "", err
+	}
+
 	token := jwt.New(jwt.SigningMethodHS256)
 
 	claims := token.Claims.(jwt.MapClaims)
 	claims["auth_id"] = auth.AuthID
-	claims["account_id"] = auth.AccountID
+	claims["account_id"] = accountID
 	claims["username"] = auth.Username
 	claims["exp"] = time.Now().Add(time.Hour * 2).Unix()
 
@@ -145,18 +163,20 @@ func (a *authImplement) AuthSignUp(ctx *gin.Context) {
 }
 
 type authUpsertPayload struct {
-	AccountID int64  `json:"account_id"`
-	Username  string `json:"username"`
-	Password  string `json:"password"`
+	AccountID int64  `json:"account_id" binding:"required"`
+	Username  string `json:"username" binding:"required"`
+	Password  string `json:"password" binding:"required"`
 }
 
+// Upsert creates a login as the first owner of an account that has no
+// members yet. It is meant for support staff behind the admin key. Existing
+// logins are never changed, and further members join through invitations.
 func (a *authImplement) Upsert(c *gin.Context) {
 	payload := authUpsertPayload{}
 
-	err := c.BindJSON(&payload)
-	if err != nil {
+	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"error": err,
+			"error": err.Error(),
 		})
 		return
 	}
@@ -164,43 +184,92 @@ func (a *authImplement) Upsert(c *gin.Context) {
 	hashed, err := bcrypt.GenerateFromPassword([]byte(payload.Password), bcrypt.DefaultCost)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"error": err,
+			"error": err.Error(),
 		})
 		return
 	}
 
-	var account model.Account
-	if err := a.db.First(&account, payload.AccountID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	tx := a.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// locking the account keeps two calls from both adding a first owner
+	if _, err := lockAccounts(tx, payload.AccountID); err != nil {
+		tx.Rollback()
+		if err == errAccountNotFound {
 			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
 				"error": "Account Not found",
 			})
 			return
 		}
-
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
 
-	auth := model.Auth{
-		AccountID: payload.AccountID,
-		Username:  payload.Username,
-		Password:  string(hashed),
+	var members int64
+	if err := tx.Model(&model.AccountMember{}).
+		Where("account_id = ?", payload.AccountID).
+		Count(&members).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if members > 0 {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Account already has members, invite the user instead",
+		})
+		return
 	}
 
-	result := a.db.Clauses(
-		clause.OnConflict{
-			DoUpdates: clause.AssignmentColumns([]string{"username", "password"}),
-			Columns:   []clause.Column{{Name: "account_id"}},
-		}).Create(&auth)
+	auth := model.Auth{
+		Username: payload.Username,
+		Password: string(hashed),
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&auth)
 	if result.Error != nil {
+		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error": result.Error.Error(),
 		})
 		return
 	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "username already exist",
+		})
+		return
+	}
+
+	member := model.AccountMember{
+		AccountID: payload.AccountID,
+		AuthID:    auth.AuthID,
+		Role:      model.RoleOwner,
+		CreatedAt: time.Now(),
+	}
+	if err := tx.Create(&member).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Create success",
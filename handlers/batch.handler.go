@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"example/model"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Batch execution modes. In all_or_nothing mode the first failing line rolls
+// back the whole batch; in best_effort mode failing lines are skipped.
+const (
+	batchAllOrNothing = "all_or_nothing"
+	batchBestEffort   = "best_effort"
+)
+
+// Statuses of a batch and of its lines.
+const (
+	batchCompleted = "completed"
+	batchPartial   = "partial"
+	batchFailed    = "failed"
+
+	itemSuccess    = "success"
+	itemFailed     = "failed"
+	itemRolledBack = "rolled_back"
+	itemSkipped    = "skipped"
+)
+
+const batchMaxItems = 1000
+
+type BatchInterface interface {
+	Create(*gin.Context)
+	List(*gin.Context)
+	Read(*gin.Context)
+}
+
+type batchImplement struct {
+	db *gorm.DB
+}
+
+func NewBatch(db *gorm.DB) BatchInterface {
+	return &batchImplement{
+		db: db,
+	}
+}
+
+type batchItemPayload struct {
+	TargetID int64  `json:"target_account_id" binding:"required"`
+	Amount   int64  `json:"amount" binding:"required,gt=0"`
+	Memo     string `json:"memo" binding:"max=140"`
+}
+
+type batchPayload struct {
+	Mode  string             `json:"mode"`
+	Items []batchItemPayload `json:"items" binding:"required,min=1,max=1000,dive"`
+}
+
+// parseBatchCSV reads target_account_id,amount lines with an optional memo
+// column. A header row is skipped.
+func parseBatchCSV(r io.Reader) ([]batchItemPayload, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var items []batchItemPayload
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(record) < 2 || len(record) > 3 {
+			return nil, fmt.Errorf("line %d: expected target_account_id,amount[,memo]", line)
+		}
+
+		if line == 1 && strings.EqualFold(record[0], "target_account_id") {
+			continue
+		}
+
+		targetID, err := strconv.ParseInt(record[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid target_account_id", line)
+		}
+		amount, err := strconv.ParseInt(record[1], 10, 64)
+		if err != nil || amount <= 0 {
+			return nil, fmt.Errorf("line %d: invalid amount", line)
+		}
+
+		item := batchItemPayload{TargetID: targetID, Amount: amount}
+		if len(record) == 3 {
+			item.Memo = record[2]
+		}
+		items = append(items, item)
+	}
+
+	if len(items) == 0 || len(items) > batchMaxItems {
+		return nil, fmt.Errorf("a batch must have between 1 and %d lines", batchMaxItems)
+	}
+
+	return items, nil
+}
+
+// bindBatch reads a batch from a JSON body or from a multipart upload with a
+// CSV "file" and a "mode" field.
+func bindBatch(ctx *gin.Context) (*batchPayload, error) {
+	payload := batchPayload{}
+
+	if strings.HasPrefix(ctx.ContentType(), "multipart/") {
+		header, err := ctx.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		if payload.Items, err = parseBatchCSV(file); err != nil {
+			return nil, err
+		}
+		payload.Mode = ctx.PostForm("mode")
+	} else if err := ctx.ShouldBindJSON(&payload); err != nil {
+		return nil, err
+	}
+
+	switch payload.Mode {
+	case "":
+		payload.Mode = batchAllOrNothing
+	case batchAllOrNothing, batchBestEffort:
+	default:
+		return nil, errors.New("mode must be all_or_nothing or best_effort")
+	}
+
+	return &payload, nil
+}
+
+// saveBatch stores a batch together with its lines.
+func saveBatch(db *gorm.DB, batch *model.TransferBatch, items []model.TransferBatchItem) error {
+	if err := db.Create(batch).Error; err != nil {
+		return err
+	}
+
+	for i := range items {
+		items[i].TransferBatchID = batch.TransferBatchID
+	}
+	return db.Create(&items).Error
+}
+
+// Create runs a batch of transfers from the caller's account and records the
+// outcome of every line.
+func (b *batchImplement) Create(ctx *gin.Context) {
+	accountID := ctx.GetInt64("account_id")
+
+	payload, err := bindBatch(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var total int64
+	ids := []int64{accountID}
+	amounts := make([]int64, len(payload.Items))
+	for i, item := range payload.Items {
+		if item.Amount > math.MaxInt64-total {
+			abortWithLedgerError(ctx, errInvalidAmount)
+			return
+		}
+		total += item.Amount
+		amounts[i] = item.Amount
+		ids = append(ids, item.TargetID)
+	}
+	// every line pays its fee to the house account, which transferFunds
+	// locks as well
+	if houseAccountID != 0 {
+		ids = append(ids, houseAccountID)
+	}
+
+	tx := b.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// lock every account of the batch up front in ascending order, like
+	// lockAccounts does for a single transfer. Unknown targets are left for
+	// their line to report.
+	var accounts []model.Account
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("account_id IN ?", ids).
+		Order("account_id").
+		Find(&accounts).Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var sender *model.Account
+	for i := range accounts {
+		if accounts[i].AccountID == accountID {
+			sender = &accounts[i]
+		}
+	}
+	if sender == nil {
+		tx.Rollback()
+		abortWithLedgerError(ctx, errAccountNotFound)
+		return
+	}
+
+	fees, err := quoteFees(tx, sender, limitTransfer, amounts, time.Now())
+	if err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := checkAvailable(tx, sender, total+fees); err != nil {
+		tx.Rollback()
+		abortWithLedgerError(ctx, err)
+		return
+	}
+
+	batch := model.TransferBatch{
+		AccountID:   accountID,
+		Mode:        payload.Mode,
+		TotalAmount: total,
+		ItemCount:   len(payload.Items),
+		CreatedAt:   time.Now(),
+	}
+	items := make([]model.TransferBatchItem, len(payload.Items))
+	failedLine := -1
+
+	for i, item := range payload.Items {
+		items[i] = model.TransferBatchItem{
+			Line:            i + 1,
+			TargetAccountID: item.TargetID,
+			Amount:          item.Amount,
+		}
+
+		// without a working savepoint a failed line can't be undone on its
+		// own, so the whole batch is given up
+		if payload.Mode == batchBestEffort {
+			if err := tx.SavePoint("item").Error; err != nil {
+				tx.Rollback()
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+		}
+
+		result, err := transferFunds(tx, categoryTransfer, accountID, item.TargetID, item.Amount, item.Memo)
+		if err != nil {
+			items[i].Status = itemFailed
+			items[i].Error = err.Error()
+
+			if payload.Mode == batchAllOrNothing {
+				failedLine = i
+				break
+			}
+			if err := tx.RollbackTo("item").Error; err != nil {
+				tx.Rollback()
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			continue
+		}
+
+		items[i].Status = itemSuccess
+		items[i].Reference = &result.Reference
+		batch.SucceededCount++
+	}
+
+	if failedLine >= 0 {
+		tx.Rollback()
+
+		for i := range items {
+			switch {
+			case i < failedLine:
+				items[i].Status = itemRolledBack
+				items[i].Reference = nil
+			case i > failedLine:
+				items[i] = model.TransferBatchItem{
+					Line:            i + 1,
+					TargetAccountID: payload.Items[i].TargetID,
+					Amount:          payload.Items[i].Amount,
+					Status:          itemSkipped,
+				}
+			}
+		}
+
+		batch.Status = batchFailed
+		batch.SucceededCount = 0
+		if err := saveBatch(b.db, &batch, items); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": fmt.Sprintf("line %d: %s", failedLine+1, items[failedLine].Error),
+			"data":  batch,
+			"items": items,
+		})
+		return
+	}
+
+	switch batch.SucceededCount {
+	case batch.ItemCount:
+		batch.Status = batchCompleted
+	case 0:
+		batch.Status = batchFailed
+	default:
+		batch.Status = batchPartial
+	}
+
+	if err := saveBatch(tx, &batch, items); err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Batch " + batch.Status,
+		"data":    batch,
+		"items":   items,
+	})
+}
+
+func (b *batchImplement) List(ctx *gin.Context) {
+	var batches []model.TransferBatch
+	accountID := ctx.GetInt64("account_id")
+
+	if err := b.db.Where("account_id = ?", accountID).Order("transfer_batch_id DESC").Find(&batches).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": batches,
+	})
+}
+
+func (b *batchImplement) Read(ctx *gin.Context) {
+	batch := model.TransferBatch{}
+	accountID := ctx.GetInt64("account_id")
+
+	if err := b.db.First(&batch, "transfer_batch_id = ? AND account_id = ?", ctx.Param("id"), accountID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Not found",
+			})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var items []model.TransferBatchItem
+	if err := b.db.Where("transfer_batch_id = ?", batch.TransferBatchID).Order("line").Find(&items).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data":  batch,
+		"items": items,
+	})
+}
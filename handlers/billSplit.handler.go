@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"errors"
+	"example/model"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Ways a bill split divides its total.
+const (
+	splitEqual   = "equal"
+	splitPercent = "percent"
+	splitExact   = "exact"
+)
+
+type BillSplitInterface interface {
+	Create(*gin.Context)
+	List(*gin.Context)
+	Read(*gin.Context)
+}
+
+type billSplitImplement struct {
+	db *gorm.DB
+}
+
+func NewBillSplit(db *gorm.DB) BillSplitInterface {
+	return &billSplitImplement{
+		db: db,
+	}
+}
+
+type splitParticipantPayload struct {
+	AccountID int64 `json:"account_id" binding:"required"`
+	// decimal fraction such as "0.25", percent mode only
+	Percent string `json:"percent"`
+	// exact mode only
+	Amount int64 `json:"amount" binding:"gte=0"`
+}
+
+type billSplitPayload struct {
+	Total        int64                     `json:"total" binding:"required,gt=0"`
+	Mode         string                    `json:"mode" binding:"required,oneof=equal percent exact"`
+	Note         string                    `json:"note" binding:"max=140"`
+	ExpiresIn    int64                     `json:"expires_in" binding:"gte=0,lte=7776000"`
+	Participants []splitParticipantPayload `json:"participants" binding:"required,min=1,max=50,dive"`
+}
+
+type billSplitShareView struct {
+	AccountID        int64   `json:"account_id"`
+	Amount           int64   `json:"amount"`
+	PaymentRequestID *int64  `json:"payment_request_id"`
+	Status           string  `json:"status"`
+	Reference        *string `json:"reference"`
+	Settled          bool    `json:"settled"`
+}
+
+// splitShares divides total between the participants. Minor units left over
+// by rounding go one each to the first participants, so the shares always
+// add up to total.
+func splitShares(mode string, total int64, participants []splitParticipantPayload) ([]int64, error) {
+	shares := make([]int64, len(participants))
+	count := int64(len(participants))
+
+	switch mode {
+	case splitEqual:
+		for n := range shares {
+			shares[n] = total / count
+		}
+	case splitPercent:
+		sum := new(big.Rat)
+		for n, participant := range participants {
+			percent, ok := new(big.Rat).SetString(participant.Percent)
+			if !ok || percent.Sign() <= 0 {
+				return nil, errors.New("every participant needs a percent between 0 and 1")
+			}
+			sum.Add(sum, percent)
+
+			share := new(big.Rat).Mul(percent, new(big.Rat).SetInt64(total))
+			shares[n] = new(big.Int).Quo(share.Num(), share.Denom()).Int64()
+		}
+		if sum.Cmp(big.NewRat(1, 1)) != 0 {
+			return nil, errors.New("percents must add up to 1")
+		}
+	case splitExact:
+		var sum int64
+		for n, participant := range participants {
+			shares[n] = participant.Amount
+			sum += participant.Amount
+		}
+		if sum != total {
+			return nil, errors.New("amounts must add up to the total")
+		}
+	}
+
+	var sum int64
+	for _, share := range shares {
+		sum += share
+	}
+	for n := 0; sum < total; n++ {
+		shares[n]++
+		sum++
+	}
+
+	return shares, nil
+}
+
+// Create records an expense paid by the caller's account and sends every
+// other participant a payment request for their share. The caller's account
+// may be a participant; its own share counts as settled.
+func (b *billSplitImplement) Create(ctx *gin.Context) {
+	payload := billSplitPayload{}
+	accountID := ctx.GetInt64("account_id")
+	authID := ctx.GetInt64("auth_id")
+
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	seen := map[int64]bool{}
+	for _, participant := range payload.Participants {
+		if seen[participant.AccountID] {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "participants must be different accounts",
+			})
+			return
+		}
+		seen[participant.AccountID] = true
+	}
+	if len(seen) == 1 && seen[accountID] {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "a split needs at least one other participant",
+		})
+		return
+	}
+
+	amounts, err := splitShares(payload.Mode, payload.Total, payload.Participants)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// every other participant is sent a payment request, which can't be
+	// for nothing
+	for n, participant := range payload.Participants {
+		if participant.AccountID != accountID && amounts[n] <= 0 {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("the share of account %d comes to 0", participant.AccountID),
+			})
+			return
+		}
+	}
+
+	account := model.Account{}
+	if err := b.db.First(&account, accountID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			abortWithLedgerError(ctx, errAccountNotFound)
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	tx := b.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	now := time.Now()
+	split := model.BillSplit{
+		AccountID: accountID,
+		Total:     payload.Total,
+		Currency:  account.Currency,
+		Mode:      payload.Mode,
+		Note:      strings.TrimSpace(payload.Note),
+		CreatedBy: authID,
+		CreatedAt: now,
+	}
+	if err := tx.Create(&split).Error; err != nil {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	shares := make([]model.BillSplitShare, len(payload.Participants))
+	for n, participant := range payload.Participants {
+		shares[n] = model.BillSplitShare{
+			BillSplitID: split.BillSplitID,
+			AccountID:   participant.AccountID,
+			Amount:      amounts[n],
+		}
+		if participant.AccountID == accountID {
+			continue
+		}
+
+		request, err := newPaymentRequest(tx, accountID, participant.AccountID, amounts[n], split.Note, authID, now.Add(expiresIn(payload.ExpiresIn, requestDefaultExpiry)))
+		if err != nil {
+			tx.Rollback()
+			abortWithLedgerError(ctx, err)
+			return
+		}
+		shares[n].PaymentRequestID = &request.PaymentRequestID
+	}
+
+	if err := tx.Create(&shares).Error; err != nil {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    split,
+		"shares":  shares,
+	})
+}
+
+// List returns the splits the caller's account started or takes part in,
+// newest first.
+func (b *billSplitImplement) List(ctx *gin.Context) {
+	var splits []model.BillSplit
+	accountID := ctx.GetInt64("account_id")
+
+	if err := b.db.Where("account_id = ? OR bill_split_id IN (?)", accountID,
+		b.db.Model(&model.BillSplitShare{}).Select("bill_split_id").Where("account_id = ?", accountID)).
+		Order("bill_split_id DESC").
+		Find(&splits).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": splits,
+	})
+}
+
+// Read returns a split with every share and whether it has been settled. A
+// share is settled once its payment request is paid.
+func (b *billSplitImplement) Read(ctx *gin.Context) {
+	var split model.BillSplit
+	accountID := ctx.GetInt64("account_id")
+
+	if err := b.db.Where("bill_split_id = ? AND (account_id = ? OR bill_split_id IN (?))", ctx.Param("id"), accountID,
+		b.db.Model(&model.BillSplitShare{}).Select("bill_split_id").Where("account_id = ?", accountID)).
+		First(&split).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Not found",
+			})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// the originator's own share has no request and is paid already
+	var shares []billSplitShareView
+	if err := b.db.Table("bill_split_share").
+		Select("bill_split_share.account_id, bill_split_share.amount, bill_split_share.payment_request_id, "+
+			"COALESCE(payment_request.status, ?) AS status, payment_request.reference", requestPaid).
+		Joins("LEFT JOIN payment_request ON payment_request.payment_request_id = bill_split_share.payment_request_id").
+		Where("bill_split_share.bill_split_id = ?", split.BillSplitID).
+		Order("bill_split_share.bill_split_share_id").
+		Scan(&shares).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var settled int64
+	for n := range shares {
+		shares[n].Settled = shares[n].Status == requestPaid
+		if shares[n].Settled {
+			settled += shares[n].Amount
+		}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data":        split,
+		"shares":      shares,
+		"settled":     settled,
+		"outstanding": split.Total - settled,
+	})
+}
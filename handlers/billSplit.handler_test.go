@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func participants(ids ...int64) []splitParticipantPayload {
+	list := make([]splitParticipantPayload, len(ids))
+	for n, id := range ids {
+		list[n] = splitParticipantPayload{AccountID: id}
+	}
+	return list
+}
+
+func TestSplitSharesEqual(t *testing.T) {
+	for total, want := range map[int64][]int64{
+		90:  {30, 30, 30},
+		100: {34, 33, 33}, // the leftover unit goes to the first participant
+		101: {34, 34, 33},
+		2:   {1, 1, 0},
+	} {
+		got, err := splitShares(splitEqual, total, participants(1, 2, 3))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%d split three ways = %v, want %v", total, got, want)
+		}
+	}
+}
+
+func TestSplitSharesPercent(t *testing.T) {
+	thirds := participants(1, 2, 3)
+	thirds[0].Percent, thirds[1].Percent, thirds[2].Percent = "1/3", "1/3", "1/3"
+
+	got, err := splitShares(splitPercent, 100, thirds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{34, 33, 33}; !slices.Equal(got, want) {
+		t.Errorf("thirds of 100 = %v, want %v", got, want)
+	}
+
+	for _, percents := range [][]string{
+		{"0.5", "0.4"},       // short of the whole
+		{"0.75", "0.5"},      // more than the whole
+		{"1", "0"},           // a participant paying nothing
+		{"1.5", "-0.5"},      // adds up, but one share is negative
+		{"0.5", "fifty pct"}, // not a number
+	} {
+		list := participants(1, 2)
+		list[0].Percent, list[1].Percent = percents[0], percents[1]
+		if got, err := splitShares(splitPercent, 100, list); err == nil {
+			t.Errorf("percents %v split into %v", percents, got)
+		}
+	}
+}
+
+func TestSplitSharesExact(t *testing.T) {
+	list := participants(1, 2)
+	list[0].Amount, list[1].Amount = 60, 40
+
+	got, err := splitShares(splitExact, 100, list)
+	if err != nil || !slices.Equal(got, []int64{60, 40}) {
+		t.Errorf("exact split = %v, %v", got, err)
+	}
+
+	list[1].Amount = 39
+	if _, err := splitShares(splitExact, 100, list); err == nil {
+		t.Error("amounts one short of the total were accepted")
+	}
+}
+
+// TestCreateSplitRejects covers the checks Create makes before it touches the
+// database, so it runs without one.
+func TestCreateSplitRejects(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for name, body := range map[string]string{
+		"a share rounding to nothing": `{"total": 2, "mode": "equal", "participants": [{"account_id": 1}, {"account_id": 2}, {"account_id": 3}]}`,
+		"an exact share of nothing":   `{"total": 100, "mode": "exact", "participants": [{"account_id": 1, "amount": 100}, {"account_id": 2, "amount": 0}]}`,
+		"the same account twice":      `{"total": 100, "mode": "equal", "participants": [{"account_id": 2}, {"account_id": 2}]}`,
+		"only the caller":             `{"total": 100, "mode": "equal", "participants": [{"account_id": 1}]}`,
+	} {
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/account/split", strings.NewReader(body))
+		ctx.Request.Header.Set("Content-Type", "application/json")
+		ctx.Set("account_id", int64(1))
+
+		NewBillSplit(nil).Create(ctx)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s returned %d, want %d", name, recorder.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"example/model"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Budget periods. A budget starts over at the beginning of every period.
+const (
+	budgetMonthly = "monthly"
+	budgetWeekly  = "weekly"
+)
+
+// budgetThresholds are the percentages of a budget at which an alert is
+// raised, once per period each.
+var budgetThresholds = []int{80, 100}
+
+type BudgetInterface interface {
+	Create(*gin.Context)
+	List(*gin.Context)
+	Update(*gin.Context)
+	Delete(*gin.Context)
+	Status(*gin.Context)
+	Alerts(*gin.Context)
+}
+
+type budgetImplement struct {
+	db *gorm.DB
+}
+
+func NewBudget(db *gorm.DB) BudgetInterface {
+	return &budgetImplement{
+		db: db,
+	}
+}
+
+type budgetPayload struct {
+	CategoryID int64  `json:"transaction_category_id" binding:"required"`
+	Amount     int64  `json:"amount" binding:"required,gt=0"`
+	Period     string `json:"period" binding:"omitempty,oneof=monthly weekly"`
+}
+
+type budgetUpdatePayload struct {
+	Amount *int64  `json:"amount" binding:"omitempty,gt=0"`
+	Period *string `json:"period" binding:"omitempty,oneof=monthly weekly"`
+}
+
+// budgetPeriod returns the bounds of the period containing now. Weeks start
+// on Monday.
+func budgetPeriod(period string, now time.Time) (time.Time, time.Time) {
+	if period == budgetWeekly {
+		day := startOfDay(now)
+		start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 7)
+	}
+
+	start := startOfMonth(now)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// budgetSpent sums the debits in the budget's category between start and end.
+func budgetSpent(db *gorm.DB, budget *model.Budget, start, end time.Time) (int64, error) {
+	var spent int64
+	err := db.Model(&model.Transaction{}).
+		Where("account_id = ? AND transaction_category_id = ? AND amount < 0", budget.AccountID, budget.TransactionCategoryID).
+		Where("transaction_date >= ? AND transaction_date < ?", start, end).
+		Select("COALESCE(-SUM(amount), 0)").
+		Scan(&spent).Error
+
+	return spent, err
+}
+
+// checkBudgets raises an alert for every budget that one of the just
+// recorded debits pushed past a threshold. Alerts are written in tx, so they
+// only exist if the money movement commits.
+func checkBudgets(tx *gorm.DB, entries []model.Transaction) error {
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Amount >= 0 {
+			continue
+		}
+
+		budget := model.Budget{}
+		result := tx.Where("account_id = ? AND transaction_category_id = ?", entry.AccountID, entry.TransactionCategoryID).
+			Limit(1).
+			Find(&budget)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		start, end := budgetPeriod(budget.Period, entry.TransactionDate)
+		spent, err := budgetSpent(tx, &budget, start, end)
+		if err != nil {
+			return err
+		}
+		before := spent + entry.Amount
+
+		for _, threshold := range budgetThresholds {
+			limit := budget.Amount * int64(threshold)
+			if spent*100 < limit || before*100 >= limit {
+				continue
+			}
+
+			alert := model.BudgetAlert{
+				BudgetID:    budget.BudgetID,
+				AccountID:   budget.AccountID,
+				PeriodStart: start,
+				Threshold:   threshold,
+				Spent:       spent,
+				Reference:   entry.Reference,
+				CreatedAt:   time.Now(),
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&alert).Error; err != nil {
+				return err
+			}
+
+			log.Printf("budget %d of account %d passed %d%%: spent %d of %d", budget.BudgetID, budget.AccountID, threshold, spent, budget.Amount)
+		}
+	}
+
+	return nil
+}
+
+// findBudget loads a budget owned by the caller, writing the error response
+// itself when it can't.
+func (b *budgetImplement) findBudget(ctx *gin.Context) (*model.Budget, bool) {
+	budget := model.Budget{}
+	accountID := ctx.GetInt64("account_id")
+
+	if err := b.db.First(&budget, "budget_id = ? AND account_id = ?", ctx.Param("id"), accountID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Not found",
+			})
+			return nil, false
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return nil, false
+	}
+
+	return &budget, true
+}
+
+func (b *budgetImplement) Create(ctx *gin.Context) {
+	payload := budgetPayload{}
+	accountID := ctx.GetInt64("account_id")
+
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if _, err := usableCategory(b.db, accountID, payload.CategoryID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Category not found",
+			})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if payload.Period == "" {
+		payload.Period = budgetMonthly
+	}
+
+	budget := model.Budget{
+		AccountID:             accountID,
+		TransactionCategoryID: payload.CategoryID,
+		Amount:                payload.Amount,
+		Period:                payload.Period,
+		CreatedAt:             time.Now(),
+	}
+	if err := b.db.Create(&budget).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    budget,
+	})
+}
+
+func (b *budgetImplement) List(ctx *gin.Context) {
+	var budgets []model.Budget
+	accountID := ctx.GetInt64("account_id")
+
+	if err := b.db.Where("account_id = ?", accountID).Order("budget_id").Find(&budgets).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": budgets,
+	})
+}
+
+func (b *budgetImplement) Update(ctx *gin.Context) {
+	payload := budgetUpdatePayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	budget, ok := b.findBudget(ctx)
+	if !ok {
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if payload.Amount != nil {
+		updates["amount"] = *payload.Amount
+	}
+	if payload.Period != nil {
+		updates["period"] = *payload.Period
+	}
+
+	if err := b.db.Model(budget).Updates(updates).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Update success",
+		"data":    budget,
+	})
+}
+
+func (b *budgetImplement) Delete(ctx *gin.Context) {
+	budget, ok := b.findBudget(ctx)
+	if !ok {
+		return
+	}
+
+	if err := b.db.Delete(budget).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Delete success",
+		"data": map[string]int64{
+			"budget_id": budget.BudgetID,
+		},
+	})
+}
+
+// Status reports spent and remaining amounts of every budget for its
+// current period.
+func (b *budgetImplement) Status(ctx *gin.Context) {
+	var budgets []model.Budget
+	accountID := ctx.GetInt64("account_id")
+
+	if err := b.db.Where("account_id = ?", accountID).Order("budget_id").Find(&budgets).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	now := time.Now()
+	statuses := make([]gin.H, 0, len(budgets))
+	for i := range budgets {
+		start, end := budgetPeriod(budgets[i].Period, now)
+		spent, err := budgetSpent(b.db, &budgets[i], start, end)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		statuses = append(statuses, gin.H{
+			"budget_id":               budgets[i].BudgetID,
+			"transaction_category_id": budgets[i].TransactionCategoryID,
+			"period":                  budgets[i].Period,
+			"period_start":            start,
+			"period_end":              end,
+			"amount":                  budgets[i].Amount,
+			"spent":                   spent,
+			"remaining":               budgets[i].Amount - spent,
+			"percent":                 spent * 100 / budgets[i].Amount,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    statuses,
+	})
+}
+
+// Alerts lists the budget alerts raised for the caller, newest first.
+func (b *budgetImplement) Alerts(ctx *gin.Context) {
+	var alerts []model.BudgetAlert
+	accountID := ctx.GetInt64("account_id")
+
+	if err := b.db.Where("account_id = ?", accountID).Order("budget_alert_id DESC").Limit(historyMaxLimit).Find(&alerts).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": alerts,
+	})
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"example/model"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CategoryInterface interface {
+	List(*gin.Context)
+	Create(*gin.Context)
+	Rename(*gin.Context)
+	Archive(*gin.Context)
+	My(*gin.Context)
+	CreateMy(*gin.Context)
+}
+
+type categoryImplement struct {
+	db *gorm.DB
+}
+
+func NewCategory(db *gorm.DB) CategoryInterface {
+	return &categoryImplement{
+		db: db,
+	}
+}
+
+type categoryPayload struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// SeedCategories makes sure every system category used by the ledger exists.
+func SeedCategories(db *gorm.DB) error {
+	for _, name := range systemCategories {
+		if _, err := categoryID(db, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// usableCategory loads a category the account may attach to its
+// transactions: a system category or one of its own, and not archived.
+func usableCategory(db *gorm.DB, accountID, categoryID int64) (*model.TransactionCategory, error) {
+	category := model.TransactionCategory{}
+	err := db.Where("transaction_category_id = ? AND archived = false AND (account_id IS NULL OR account_id = ?)", categoryID, accountID).
+		First(&category).Error
+
+	return &category, err
+}
+
+// List returns the system categories that are not archived.
+func (c *categoryImplement) List(ctx *gin.Context) {
+	var categories []model.TransactionCategory
+
+	if err := c.db.Where("account_id IS NULL AND archived = false").Order("name").Find(&categories).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": categories,
+	})
+}
+
+// Create adds a system category.
+func (c *categoryImplement) Create(ctx *gin.Context) {
+	payload := categoryPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	category := model.TransactionCategory{Name: strings.TrimSpace(payload.Name)}
+	if err := c.db.Create(&category).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    category,
+	})
+}
+
+// findSystemCategory loads a system category by the id in the url, writing
+// the error response itself when it can't.
+func (c *categoryImplement) findSystemCategory(ctx *gin.Context) (*model.TransactionCategory, bool) {
+	category := model.TransactionCategory{}
+
+	if err := c.db.First(&category, "transaction_category_id = ? AND account_id IS NULL", ctx.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Not found",
+			})
+			return nil, false
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return nil, false
+	}
+
+	return &category, true
+}
+
+// isBuiltinCategory reports whether the ledger posts to the system category.
+func isBuiltinCategory(category *model.TransactionCategory) bool {
+	for _, name := range systemCategories {
+		if category.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// canFile reports whether an entry posted as kind may be filed under
+// category. A ledger category only takes entries of its own kind, so a
+// transfer can't be passed off as a fee or a top-up.
+func canFile(category *model.TransactionCategory, kind string) bool {
+	return category.AccountID != nil || !isBuiltinCategory(category) || category.Name == kind
+}
+
+// Rename changes the name of a system category. Categories the ledger posts
+// to can't be renamed, since it finds them by name.
+func (c *categoryImplement) Rename(ctx *gin.Context) {
+	payload := categoryPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	category, ok := c.findSystemCategory(ctx)
+	if !ok {
+		return
+	}
+
+	if isBuiltinCategory(category) {
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Built-in categories can't be renamed",
+		})
+		return
+	}
+
+	if err := c.db.Model(category).Update("name", strings.TrimSpace(payload.Name)).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Update success",
+		"data":    category,
+	})
+}
+
+// Archive hides a system category from the list and stops it from being
+// attached to transactions. Transactions already in it keep it. Categories
+// the ledger posts to can't be archived.
+func (c *categoryImplement) Archive(ctx *gin.Context) {
+	category, ok := c.findSystemCategory(ctx)
+	if !ok {
+		return
+	}
+
+	if isBuiltinCategory(category) {
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Built-in categories can't be archived",
+		})
+		return
+	}
+
+	if err := c.db.Model(category).Update("archived", true).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Archive success",
+		"data":    category,
+	})
+}
+
+// My returns the categories the caller can use: the system ones and their
+// own.
+func (c *categoryImplement) My(ctx *gin.Context) {
+	var categories []model.TransactionCategory
+	accountID := ctx.GetInt64("account_id")
+
+	if err := c.db.Where("archived = false AND (account_id IS NULL OR account_id = ?)", accountID).
+		Order("account_id NULLS FIRST, name").
+		Find(&categories).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": categories,
+	})
+}
+
+// CreateMy adds a category owned by the caller's account.
+func (c *categoryImplement) CreateMy(ctx *gin.Context) {
+	payload := categoryPayload{}
+	accountID := ctx.GetInt64("account_id")
+
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	category := model.TransactionCategory{
+		AccountID: &accountID,
+		Name:      strings.TrimSpace(payload.Name),
+	}
+	if err := c.db.Create(&category).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    category,
+	})
+}
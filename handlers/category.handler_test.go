@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"example/model"
+	"testing"
+)
+
+func TestCanFile(t *testing.T) {
+	owner := int64(7)
+	system := func(name string) *model.TransactionCategory {
+		return &model.TransactionCategory{Name: name}
+	}
+
+	cases := map[string]struct {
+		category *model.TransactionCategory
+		kind     string
+		want     bool
+	}{
+		"transfer into a personal category":      {&model.TransactionCategory{Name: "Groceries", AccountID: &owner}, categoryTransfer, true},
+		"top-up into a personal category":        {&model.TransactionCategory{Name: "Salary", AccountID: &owner}, categoryTopUp, true},
+		"personal category named like a kind":    {&model.TransactionCategory{Name: categoryFee, AccountID: &owner}, categoryTransfer, true},
+		"transfer into an admin category":        {system("Travel"), categoryTransfer, true},
+		"transfer back to transfer":              {system(categoryTransfer), categoryTransfer, true},
+		"withdrawal back to withdrawal":          {system(categoryWithdrawal), categoryWithdrawal, true},
+		"transfer passed off as a fee":           {system(categoryFee), categoryTransfer, false},
+		"withdrawal passed off as an adjustment": {system(categoryAdjustment), categoryWithdrawal, false},
+		"transfer passed off as a refund":        {system(categoryReversal), categoryTransfer, false},
+		"top-up filed as a transfer":             {system(categoryTransfer), categoryTopUp, false},
+		"transfer filed as a top-up":             {system(categoryTopUp), categoryTransfer, false},
+	}
+
+	for name, c := range cases {
+		if got := canFile(c.category, c.kind); got != c.want {
+			t.Errorf("%s: canFile(%q, %q) = %v, want %v", name, c.category.Name, c.kind, got, c.want)
+		}
+	}
+}
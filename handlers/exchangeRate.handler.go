@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"example/model"
+	"example/utils"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ExchangeRateInterface interface {
+	List(*gin.Context)
+	Upsert(*gin.Context)
+}
+
+type exchangeRateImplement struct {
+	db *gorm.DB
+}
+
+func NewExchangeRate(db *gorm.DB) ExchangeRateInterface {
+	return &exchangeRateImplement{
+		db: db,
+	}
+}
+
+type exchangeRatePayload struct {
+	BaseCurrency  string `json:"base_currency" binding:"required"`
+	QuoteCurrency string `json:"quote_currency" binding:"required"`
+	Rate          string `json:"rate" binding:"required"`
+}
+
+// upsertExchangeRate validates a rate and stores it, replacing any earlier
+// rate for the same currency pair.
+func upsertExchangeRate(db *gorm.DB, payload exchangeRatePayload) (*model.ExchangeRate, error) {
+	base := strings.ToUpper(payload.BaseCurrency)
+	quote := strings.ToUpper(payload.QuoteCurrency)
+
+	if !utils.CurrencySupported(base) || !utils.CurrencySupported(quote) {
+		return nil, errors.New("unsupported currency")
+	}
+	if base == quote {
+		return nil, errors.New("base and quote currency must differ")
+	}
+	if _, err := utils.ParseRate(payload.Rate); err != nil {
+		return nil, err
+	}
+
+	rate := model.ExchangeRate{
+		BaseCurrency:  base,
+		QuoteCurrency: quote,
+		Rate:          payload.Rate,
+		UpdatedAt:     time.Now(),
+	}
+
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base_currency"}, {Name: "quote_currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at"}),
+	}).Create(&rate).Error; err != nil {
+		return nil, err
+	}
+
+	return &rate, nil
+}
+
+// LoadExchangeRates reads rates from a CSV file with base_currency,
+// quote_currency and rate columns. A header row is skipped.
+func LoadExchangeRates(db *gorm.DB, path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	loaded := 0
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return loaded, nil
+		}
+		if err != nil {
+			return loaded, err
+		}
+
+		if line == 1 && strings.EqualFold(record[0], "base_currency") {
+			continue
+		}
+
+		payload := exchangeRatePayload{
+			BaseCurrency:  record[0],
+			QuoteCurrency: record[1],
+			Rate:          record[2],
+		}
+		if _, err := upsertExchangeRate(db, payload); err != nil {
+			return loaded, fmt.Errorf("line %d: %w", line, err)
+		}
+		loaded++
+	}
+}
+
+func (e *exchangeRateImplement) List(ctx *gin.Context) {
+	var rates []model.ExchangeRate
+
+	if err := e.db.Order("base_currency, quote_currency").Find(&rates).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": rates,
+	})
+}
+
+func (e *exchangeRateImplement) Upsert(ctx *gin.Context) {
+	payload := exchangeRatePayload{}
+
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	rate, err := upsertExchangeRate(e.db, payload)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Update success",
+		"data":    rate,
+	})
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestUpsertExchangeRateRejects runs without a database: every case must be
+// turned down before anything is written.
+func TestUpsertExchangeRateRejects(t *testing.T) {
+	for name, payload := range map[string]exchangeRatePayload{
+		"the same currency in another case": {BaseCurrency: "usd", QuoteCurrency: "USD", Rate: "1"},
+		"an unknown currency":               {BaseCurrency: "USD", QuoteCurrency: "XAU", Rate: "0.0004"},
+		"a fraction":                        {BaseCurrency: "usd", QuoteCurrency: "idr", Rate: "63000/4"},
+		"an exponent":                       {BaseCurrency: "usd", QuoteCurrency: "idr", Rate: "1.575e4"},
+		"a zero rate":                       {BaseCurrency: "usd", QuoteCurrency: "idr", Rate: "0"},
+	} {
+		if _, err := upsertExchangeRate(nil, payload); err == nil {
+			t.Errorf("%s was accepted", name)
+		}
+	}
+}
+
+func TestLoadExchangeRatesReportsLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.csv")
+	if err := os.WriteFile(path, []byte("base_currency,quote_currency,rate\nUSD,IDR,1e4\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadExchangeRates(nil, path)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("LoadExchangeRates returned %v, want an error on line 2", err)
+	}
+	if loaded != 0 {
+		t.Errorf("loaded %d rates before the bad line, want 0", loaded)
+	}
+}
+
+func TestUpsertExchangeRateUpperCases(t *testing.T) {
+	db := testDB(t)
+
+	rate, err := upsertExchangeRate(db, exchangeRatePayload{BaseCurrency: "sgd", QuoteCurrency: "myr", Rate: "3.45"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate.BaseCurrency != "SGD" || rate.QuoteCurrency != "MYR" {
+		t.Errorf("stored %s/%s, want SGD/MYR", rate.BaseCurrency, rate.QuoteCurrency)
+	}
+
+	got, err := exchangeRate(db, "SGD", "MYR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FloatString(2) != "3.45" {
+		t.Errorf("exchangeRate(SGD, MYR) = %s, want 3.45", got.FloatString(2))
+	}
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"example/model"
+	"math/big"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// houseAccountID is the revenue account fees are paid into. Fees are off
+// while it is zero.
+var houseAccountID int64
+
+// SetHouseAccount sets the revenue account fees are paid into. Zero turns
+// fees off.
+func SetHouseAccount(id int64) {
+	houseAccountID = id
+}
+
+// feeQuote is the fee an operation on amount is charged right now, in the
+// account's currency. FreeRemaining is nil when the rule has no free quota.
+type feeQuote struct {
+	Operation     string `json:"operation"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+	Fee           int64  `json:"fee"`
+	Free          bool   `json:"free"`
+	FreeRemaining *int64 `json:"free_remaining"`
+
+	rule *model.FeeRule
+}
+
+// ruleFee prices amount with a rule. The percentage is rounded down to a
+// whole minor unit before the caps are applied.
+func ruleFee(rule *model.FeeRule, amount int64) (int64, error) {
+	percent, ok := new(big.Rat).SetString(rule.Percent)
+	if !ok {
+		return 0, errors.New("invalid fee percent " + rule.Percent)
+	}
+
+	variable := percent.Mul(percent, new(big.Rat).SetInt64(amount))
+	fee := rule.Flat + new(big.Int).Quo(variable.Num(), variable.Denom()).Int64()
+
+	if fee < rule.MinFee {
+		fee = rule.MinFee
+	}
+	if rule.MaxFee > 0 && fee > rule.MaxFee {
+		fee = rule.MaxFee
+	}
+	return fee, nil
+}
+
+// freeFeesUsed counts the free operations an account has had this month.
+func freeFeesUsed(db *gorm.DB, accountID int64, operation string, now time.Time) (int64, error) {
+	var used int64
+	err := db.Model(&model.FeeCharge{}).
+		Where("account_id = ? AND operation = ? AND free AND created_at >= ?", accountID, operation, startOfMonth(now)).
+		Count(&used).Error
+
+	return used, err
+}
+
+// priceFee fills in the fee of a quote under rule, given the free operations
+// already used this month.
+func priceFee(quote *feeQuote, rule *model.FeeRule, used int64) error {
+	quote.rule = rule
+
+	if rule.FreePerMonth > 0 {
+		remaining := max(rule.FreePerMonth-used, 0)
+		quote.FreeRemaining = &remaining
+		if remaining > 0 {
+			quote.Free = true
+			return nil
+		}
+	}
+
+	fee, err := ruleFee(rule, quote.Amount)
+	if err != nil {
+		return err
+	}
+	quote.Fee = fee
+
+	return nil
+}
+
+// quoteFee evaluates the fee of an operation on amount for an account. The
+// rule with the highest MinAmount not above amount applies; without one, or
+// while fees are off, the operation costs nothing. Quoting inside the tx that
+// locks the account gives the fee that will be charged.
+func quoteFee(db *gorm.DB, account *model.Account, operation string, amount int64, now time.Time) (*feeQuote, error) {
+	quote := feeQuote{
+		Operation: operation,
+		Amount:    amount,
+		Currency:  account.Currency,
+	}
+	if houseAccountID == 0 || account.AccountID == houseAccountID {
+		return &quote, nil
+	}
+
+	rule := model.FeeRule{}
+	result := db.Where("operation = ? AND currency = ? AND min_amount <= ?", operation, account.Currency, amount).
+		Order("min_amount DESC").
+		Limit(1).
+		Find(&rule)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &quote, nil
+	}
+
+	var used int64
+	if rule.FreePerMonth > 0 {
+		var err error
+		if used, err = freeFeesUsed(db, account.AccountID, operation, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := priceFee(&quote, &rule, used); err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
+
+// quoteFees adds up the fees of a series of operations on the amounts, run
+// one after the other so earlier ones use up the free quota first.
+func quoteFees(db *gorm.DB, account *model.Account, operation string, amounts []int64, now time.Time) (int64, error) {
+	if houseAccountID == 0 || account.AccountID == houseAccountID {
+		return 0, nil
+	}
+
+	var rules []model.FeeRule
+	if err := db.Where("operation = ? AND currency = ?", operation, account.Currency).
+		Order("min_amount DESC").
+		Find(&rules).Error; err != nil {
+		return 0, err
+	}
+	if len(rules) == 0 {
+		return 0, nil
+	}
+
+	used, err := freeFeesUsed(db, account.AccountID, operation, now)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, amount := range amounts {
+		for i := range rules {
+			if rules[i].MinAmount > amount {
+				continue
+			}
+
+			quote := feeQuote{Operation: operation, Amount: amount}
+			if err := priceFee(&quote, &rules[i], used); err != nil {
+				return 0, err
+			}
+			if quote.Free {
+				used++
+			}
+			total += quote.Fee
+			break
+		}
+	}
+
+	return total, nil
+}
+
+// postFee charges a quoted fee for the movement with the given reference and
+// records the charge, free ones included so they count toward the quota. The
+// fee is journaled as a transfer of its own from the locked payer to the
+// locked house account. It must run inside the tx that made the movement.
+func postFee(tx *gorm.DB, payer, house *model.Account, quote *feeQuote, reference string) (*model.FeeCharge, error) {
+	if quote.rule == nil {
+		return nil, nil
+	}
+
+	charge := model.FeeCharge{
+		AccountID: payer.AccountID,
+		Operation: quote.Operation,
+		Reference: reference,
+		Amount:    quote.Amount,
+		Fee:       quote.Fee,
+		Free:      quote.Free,
+		CreatedAt: time.Now(),
+	}
+
+	if quote.Fee > 0 {
+		credit, rateText, err := convertFunds(tx, payer.Currency, house.Currency, quote.Fee)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := addBalance(tx, payer, -quote.Fee); err != nil {
+			return nil, err
+		}
+		if err := addBalance(tx, house, credit); err != nil {
+			return nil, err
+		}
+
+		feeReference, err := recordTransfer(tx, categoryFee, payer, house, quote.Fee, credit, rateText, "Fee for "+reference)
+		if err != nil {
+			return nil, err
+		}
+		charge.FeeReference = &feeReference
+	}
+
+	if err := tx.Create(&charge).Error; err != nil {
+		return nil, err
+	}
+
+	return &charge, nil
+}
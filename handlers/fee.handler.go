@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"example/model"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type FeeInterface interface {
+	Rules(*gin.Context)
+	SetRules(*gin.Context)
+	Quote(*gin.Context)
+}
+
+type feeImplement struct {
+	db *gorm.DB
+}
+
+func NewFee(db *gorm.DB) FeeInterface {
+	return &feeImplement{
+		db: db,
+	}
+}
+
+type feeRulePayload struct {
+	MinAmount    int64  `json:"min_amount" binding:"gte=0"`
+	Flat         int64  `json:"flat" binding:"gte=0"`
+	Percent      string `json:"percent"`
+	MinFee       int64  `json:"min_fee" binding:"gte=0"`
+	MaxFee       int64  `json:"max_fee" binding:"gte=0"`
+	FreePerMonth int64  `json:"free_per_month" binding:"gte=0"`
+}
+
+type feeRulesPayload struct {
+	Operation string           `json:"operation" binding:"required,oneof=transfer topup"`
+	Currency  string           `json:"currency" binding:"required,len=3"`
+	Rules     []feeRulePayload `json:"rules" binding:"dive"`
+}
+
+// Rules lists the fee rules of every operation and currency.
+func (f *feeImplement) Rules(ctx *gin.Context) {
+	var rules []model.FeeRule
+
+	if err := f.db.Order("operation, currency, min_amount").Find(&rules).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": rules,
+	})
+}
+
+// SetRules replaces the fee rules of an operation in a currency. An empty
+// list makes the operation free.
+func (f *feeImplement) SetRules(ctx *gin.Context) {
+	payload := feeRulesPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	currency := strings.ToUpper(payload.Currency)
+	rules := make([]model.FeeRule, len(payload.Rules))
+	for n, rule := range payload.Rules {
+		if rule.Percent == "" {
+			rule.Percent = "0"
+		}
+
+		percent, ok := new(big.Rat).SetString(rule.Percent)
+		if !ok || percent.Sign() < 0 || percent.Cmp(big.NewRat(1, 1)) > 0 {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "percent must be a decimal fraction between 0 and 1",
+			})
+			return
+		}
+		if rule.MaxFee > 0 && rule.MaxFee < rule.MinFee {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "max_fee can't be less than min_fee",
+			})
+			return
+		}
+
+		rules[n] = model.FeeRule{
+			Operation:    payload.Operation,
+			Currency:     currency,
+			MinAmount:    rule.MinAmount,
+			Flat:         rule.Flat,
+			Percent:      rule.Percent,
+			MinFee:       rule.MinFee,
+			MaxFee:       rule.MaxFee,
+			FreePerMonth: rule.FreePerMonth,
+		}
+	}
+
+	err := f.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("operation = ? AND currency = ?", payload.Operation, currency).Delete(&model.FeeRule{}).Error; err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.Create(&rules).Error
+	})
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Update success",
+		"data":    rules,
+	})
+}
+
+// Quote shows the fee the caller's account would pay for an operation on an
+// amount right now, and what it comes to in total: the debit of a transfer
+// or the net credit of a top-up.
+func (f *feeImplement) Quote(ctx *gin.Context) {
+	var account model.Account
+	accountID := ctx.GetInt64("account_id")
+
+	operation := ctx.DefaultQuery("operation", limitTransfer)
+	if operation != limitTransfer && operation != limitTopUp {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "operation must be transfer or topup",
+		})
+		return
+	}
+
+	amount, err := strconv.ParseInt(ctx.Query("amount"), 10, 64)
+	if err != nil || amount <= 0 {
+		abortWithLedgerError(ctx, errInvalidAmount)
+		return
+	}
+
+	if err := f.db.First(&account, accountID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			abortWithLedgerError(ctx, errAccountNotFound)
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	quote, err := quoteFee(f.db, &account, operation, amount, time.Now())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	total := amount + quote.Fee
+	if operation == limitTopUp {
+		total = amount - quote.Fee
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    quote,
+		"total":   total,
+	})
+}
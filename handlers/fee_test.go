@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"example/model"
+	"testing"
+)
+
+func TestRuleFee(t *testing.T) {
+	transfer := model.FeeRule{Flat: 1000, Percent: "0.005", MinFee: 2500, MaxFee: 25000}
+
+	for _, c := range []struct {
+		amount, want int64
+	}{
+		{0, 2500},           // the flat part alone is under the minimum
+		{300000, 2500},      // 1000 + 1500 lands on the minimum
+		{300199, 2500},      // the half unit is dropped, not rounded up
+		{300200, 2501},      // first amount above the minimum
+		{4800000, 25000},    // 1000 + 24000 lands on the cap
+		{1000000000, 25000}, // far past the cap
+	} {
+		got, err := ruleFee(&transfer, c.amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("ruleFee(%d) = %d, want %d", c.amount, got, c.want)
+		}
+	}
+
+	uncapped := model.FeeRule{Percent: "0.001"}
+	if got, _ := ruleFee(&uncapped, 100000000); got != 100000 {
+		t.Errorf("a zero max fee capped the fee at %d", got)
+	}
+
+	if _, err := ruleFee(&model.FeeRule{Percent: "0.5%"}, 1000); err == nil {
+		t.Error("a percent sign in the rule was accepted")
+	}
+}
+
+// TestPriceFeeFreeQuota walks through a month with three free transfers.
+func TestPriceFeeFreeQuota(t *testing.T) {
+	rule := model.FeeRule{Flat: 2500, Percent: "0", FreePerMonth: 3}
+
+	for used, want := range []struct {
+		free      bool
+		fee       int64
+		remaining int64
+	}{
+		{true, 0, 3},
+		{true, 0, 2},
+		{true, 0, 1},
+		{false, 2500, 0},
+		{false, 2500, 0}, // more than the quota used never goes negative
+	} {
+		quote := feeQuote{Amount: 50000}
+		if err := priceFee(&quote, &rule, int64(used)); err != nil {
+			t.Fatal(err)
+		}
+
+		if quote.Free != want.free || quote.Fee != want.fee {
+			t.Errorf("with %d used: free %t fee %d, want free %t fee %d", used, quote.Free, quote.Fee, want.free, want.fee)
+		}
+		if quote.FreeRemaining == nil || *quote.FreeRemaining != want.remaining {
+			t.Errorf("with %d used: remaining %v, want %d", used, quote.FreeRemaining, want.remaining)
+		}
+		if quote.rule != &rule {
+			t.Errorf("with %d used: the quote lost its rule, so the charge wouldn't be recorded", used)
+		}
+	}
+
+	quote := feeQuote{Amount: 50000}
+	if err := priceFee(&quote, &model.FeeRule{Flat: 2500, Percent: "0"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if quote.FreeRemaining != nil || quote.Free {
+		t.Error("a rule without a quota reported free operations")
+	}
+}
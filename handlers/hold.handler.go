@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"example/model"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Statuses a hold can be in. Only active holds that have not expired reduce
+// the available balance.
+const (
+	holdActive   = "active"
+	holdCaptured = "captured"
+	holdVoided   = "voided"
+	holdExpired  = "expired"
+)
+
+const holdDefaultExpiry = 7 * 24 * time.Hour
+
+type HoldInterface interface {
+	Create(*gin.Context)
+	List(*gin.Context)
+	Capture(*gin.Context)
+	Void(*gin.Context)
+}
+
+type holdImplement struct {
+	db *gorm.DB
+}
+
+func NewHold(db *gorm.DB) HoldInterface {
+	return &holdImplement{
+		db: db,
+	}
+}
+
+type holdPayload struct {
+	MerchantID int64 `json:"merchant_account_id" binding:"required"`
+	Amount     int64 `json:"amount" binding:"required,gt=0"`
+	// seconds until the hold expires, defaults to seven days
+	ExpiresIn int64 `json:"expires_in" binding:"gte=0,lte=7776000"`
+}
+
+type capturePayload struct {
+	Amount int64 `json:"amount" binding:"gte=0"`
+}
+
+// lockHold loads a hold with SELECT ... FOR UPDATE, writing the error
+// response itself when it can't.
+func lockHold(ctx *gin.Context, tx *gorm.DB) (*model.Hold, bool) {
+	hold := model.Hold{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&hold, "hold_id = ?", ctx.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Not found",
+			})
+			return nil, false
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return nil, false
+	}
+
+	return &hold, true
+}
+
+// Create reserves part of the caller's available balance for a merchant.
+func (h *holdImplement) Create(ctx *gin.Context) {
+	payload := holdPayload{}
+	accountID := ctx.GetInt64("account_id")
+
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if payload.MerchantID == accountID {
+		abortWithLedgerError(ctx, errSameAccount)
+		return
+	}
+
+	tx := h.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// locking both accounts makes the available balance check safe against
+	// concurrent transfers and holds
+	accounts, err := lockAccounts(tx, accountID, payload.MerchantID)
+	if err != nil {
+		tx.Rollback()
+		abortWithLedgerError(ctx, err)
+		return
+	}
+
+	if err := checkActive(accounts[accountID], accounts[payload.MerchantID]); err != nil {
+		tx.Rollback()
+		abortWithLedgerError(ctx, err)
+		return
+	}
+
+	if err := checkAvailable(tx, accounts[accountID], payload.Amount); err != nil {
+		tx.Rollback()
+		abortWithLedgerError(ctx, err)
+		return
+	}
+
+	now := time.Now()
+	hold := model.Hold{
+		AccountID:         accountID,
+		MerchantAccountID: payload.MerchantID,
+		Amount:            payload.Amount,
+		Status:            holdActive,
+		ExpiresAt:         now.Add(expiresIn(payload.ExpiresIn, holdDefaultExpiry)),
+		CreatedAt:         now,
+	}
+	if err := tx.Create(&hold).Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    hold,
+	})
+}
+
+// List returns holds placed on the caller's account and holds placed in the
+// caller's favour.
+func (h *holdImplement) List(ctx *gin.Context) {
+	var holds []model.Hold
+	accountID := ctx.GetInt64("account_id")
+
+	if err := h.db.Where("account_id = ? OR merchant_account_id = ?", accountID, accountID).
+		Order("hold_id DESC").
+		Find(&holds).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": holds,
+	})
+}
+
+// Capture lets the merchant turn all or part of a hold into a transfer. The
+// rest of the hold is released.
+func (h *holdImplement) Capture(ctx *gin.Context) {
+	payload := capturePayload{}
+	accountID := ctx.GetInt64("account_id")
+
+	// an empty body captures the full hold
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&payload); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+
+	tx := h.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	hold, ok := lockHold(ctx, tx)
+	if !ok {
+		tx.Rollback()
+		return
+	}
+
+	if hold.MerchantAccountID != accountID {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Only the merchant can capture a hold",
+		})
+		return
+	}
+
+	if hold.Status != holdActive || !hold.ExpiresAt.After(time.Now()) {
+		tx.Rollback()
+		abortWithLedgerError(ctx, errHoldNotActive)
+		return
+	}
+
+	amount := payload.Amount
+	if amount == 0 {
+		amount = hold.Amount
+	}
+	if amount > hold.Amount {
+		tx.Rollback()
+		abortWithLedgerError(ctx, errCaptureTooLarge)
+		return
+	}
+
+	// close the hold first so the reserved amount is available to the
+	// transfer below
+	if err := tx.Model(hold).Updates(map[string]interface{}{
+		"status":          holdCaptured,
+		"captured_amount": amount,
+	}).Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	result, err := transferFunds(tx, categoryCapture, hold.AccountID, hold.MerchantAccountID, amount, fmt.Sprintf("Hold %d", hold.HoldID))
+	if err != nil {
+		tx.Rollback()
+		abortWithLedgerError(ctx, err)
+		return
+	}
+
+	if err := tx.Model(hold).Update("reference", result.Reference).Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":   "Capture success",
+		"data":      hold,
+		"reference": result.Reference,
+	})
+}
+
+// Void releases a hold without moving any money. Both the account holder and
+// the merchant may void it.
+func (h *holdImplement) Void(ctx *gin.Context) {
+	accountID := ctx.GetInt64("account_id")
+
+	tx := h.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	hold, ok := lockHold(ctx, tx)
+	if !ok {
+		tx.Rollback()
+		return
+	}
+
+	if hold.AccountID != accountID && hold.MerchantAccountID != accountID {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Forbidden",
+		})
+		return
+	}
+
+	if hold.Status != holdActive {
+		tx.Rollback()
+		abortWithLedgerError(ctx, errHoldNotActive)
+		return
+	}
+
+	// a hold that ran out on its own is recorded as expired
+	status := holdVoided
+	if !hold.ExpiresAt.After(time.Now()) {
+		status = holdExpired
+	}
+
+	if err := tx.Model(hold).Update("status", status).Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Void success",
+		"data":    hold,
+	})
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"example/model"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type InterestInterface interface {
+	Tiers(*gin.Context)
+	SetTiers(*gin.Context)
+	Run(*gin.Context)
+}
+
+type interestImplement struct {
+	db *gorm.DB
+}
+
+func NewInterest(db *gorm.DB) InterestInterface {
+	return &interestImplement{
+		db: db,
+	}
+}
+
+type interestTierPayload struct {
+	MinBalance int64  `json:"min_balance" binding:"gte=0"`
+	AnnualRate string `json:"annual_rate" binding:"required"`
+}
+
+type interestTiersPayload struct {
+	Currency string                `json:"currency" binding:"required,len=3"`
+	Tiers    []interestTierPayload `json:"tiers" binding:"dive"`
+}
+
+// Tiers lists the interest rate tiers of every currency.
+func (i *interestImplement) Tiers(ctx *gin.Context) {
+	var tiers []model.InterestTier
+
+	if err := i.db.Order("currency, min_balance").Find(&tiers).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": tiers,
+	})
+}
+
+// SetTiers replaces the interest rate tiers of a currency. An empty list
+// stops the currency from earning interest.
+func (i *interestImplement) SetTiers(ctx *gin.Context) {
+	payload := interestTiersPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	currency := strings.ToUpper(payload.Currency)
+	tiers := make([]model.InterestTier, len(payload.Tiers))
+	for n, tier := range payload.Tiers {
+		rate, ok := new(big.Rat).SetString(tier.AnnualRate)
+		if !ok || rate.Sign() < 0 || rate.Cmp(big.NewRat(1, 1)) > 0 {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "annual_rate must be a decimal fraction between 0 and 1",
+			})
+			return
+		}
+
+		tiers[n] = model.InterestTier{
+			Currency:   currency,
+			MinBalance: tier.MinBalance,
+			AnnualRate: tier.AnnualRate,
+		}
+	}
+
+	err := i.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("currency = ?", currency).Delete(&model.InterestTier{}).Error; err != nil {
+			return err
+		}
+		if len(tiers) == 0 {
+			return nil
+		}
+		return tx.Create(&tiers).Error
+	})
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Update success",
+		"data":    tiers,
+	})
+}
+
+// Run accrues interest now instead of waiting for the worker. With dry_run
+// set it only reports what would be accrued and posted. A date (YYYY-MM-DD)
+// runs as if it were that day; a future one only as a dry run.
+func (i *interestImplement) Run(ctx *gin.Context) {
+	now := time.Now()
+	dryRun := ctx.Query("dry_run") == "true"
+	if value := ctx.Query("date"); value != "" {
+		day, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid date",
+			})
+			return
+		}
+
+		// posting days that haven't happened yet would make the worker skip
+		// them once they do
+		if day.After(startOfDay(now)) && !dryRun {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "a future date needs dry_run=true",
+			})
+			return
+		}
+		now = day
+	}
+
+	report, err := RunInterest(i.db, now, dryRun)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    report,
+	})
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"errors"
+	"example/model"
+	"log"
+	"math/big"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errDryRun rolls back the transaction of an account in a dry run once its
+// result has been recorded.
+var errDryRun = errors.New("dry run")
+
+// InterestResult is what one run accrued and posted for an account. Interest
+// and Accrued are decimals of a minor unit rounded for display; the exact
+// fraction is kept in interest_accrual.
+type InterestResult struct {
+	AccountID int64  `json:"account_id"`
+	Currency  string `json:"currency"`
+	Balance   int64  `json:"balance"`
+	Days      int    `json:"days"`
+	Interest  string `json:"interest"`
+	Accrued   string `json:"accrued"`
+	Posted    int64  `json:"posted"`
+	Reference string `json:"reference,omitempty"`
+}
+
+// InterestFailure is an account a run could not accrue. It is retried on
+// the next run.
+type InterestFailure struct {
+	AccountID int64  `json:"account_id"`
+	Error     string `json:"error"`
+}
+
+type InterestReport struct {
+	RunAt    time.Time         `json:"run_at"`
+	Through  time.Time         `json:"through"`
+	DryRun   bool              `json:"dry_run"`
+	Accounts []InterestResult  `json:"accounts"`
+	Failed   []InterestFailure `json:"failed"`
+}
+
+// InterestWorker accrues interest in the background.
+type InterestWorker struct {
+	db *gorm.DB
+}
+
+func NewInterestWorker(db *gorm.DB) *InterestWorker {
+	return &InterestWorker{
+		db: db,
+	}
+}
+
+// Start runs the accrual every interval in a new goroutine. Days already
+// accrued are skipped, so the interval only bounds how late a day is
+// accrued.
+func (w *InterestWorker) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			if _, err := RunInterest(w.db, now, false); err != nil {
+				log.Printf("interest worker: %v", err)
+			}
+		}
+	}()
+}
+
+// dailyInterest returns one day of interest on balance. Every tier earns its
+// rate on the part of the balance inside its band. Tiers must be sorted by
+// MinBalance.
+func dailyInterest(tiers []model.InterestTier, balance int64, day time.Time) (*big.Rat, error) {
+	interest := new(big.Rat)
+
+	for i, tier := range tiers {
+		if balance <= tier.MinBalance {
+			break
+		}
+
+		top := balance
+		if i+1 < len(tiers) && tiers[i+1].MinBalance < balance {
+			top = tiers[i+1].MinBalance
+		}
+
+		rate, ok := new(big.Rat).SetString(tier.AnnualRate)
+		if !ok {
+			return nil, errors.New("invalid annual rate " + tier.AnnualRate)
+		}
+
+		band := new(big.Rat).SetInt64(top - tier.MinBalance)
+		interest.Add(interest, band.Mul(band, rate))
+	}
+
+	// actual/actual: a day is a 365th or a 366th of the year's rate
+	days := time.Date(day.Year(), 12, 31, 0, 0, 0, 0, day.Location()).YearDay()
+	return interest.Quo(interest, new(big.Rat).SetInt64(int64(days))), nil
+}
+
+// RunInterest accrues interest for every day up to the day before now that an
+// account has not accrued yet, using its current balance. Once a month has
+// been fully accrued the whole minor units are posted as an interest entry
+// and the remaining fraction is carried over. An account that fails is
+// logged and listed in the report, and the run goes on with the others. With
+// dryRun set nothing is saved and the report shows what would have been.
+func RunInterest(db *gorm.DB, now time.Time, dryRun bool) (*InterestReport, error) {
+	through := startOfDay(now).AddDate(0, 0, -1)
+	report := InterestReport{
+		RunAt:    now,
+		Through:  through,
+		DryRun:   dryRun,
+		Accounts: []InterestResult{},
+		Failed:   []InterestFailure{},
+	}
+
+	var tiers []model.InterestTier
+	if err := db.Order("currency, min_balance").Find(&tiers).Error; err != nil {
+		return nil, err
+	}
+	tiersByCurrency := map[string][]model.InterestTier{}
+	for _, tier := range tiers {
+		tiersByCurrency[tier.Currency] = append(tiersByCurrency[tier.Currency], tier)
+	}
+
+	var ids []int64
+	if err := db.Model(&model.Account{}).
+		Where("status <> ?", accountClosed).
+		Order("account_id").
+		Pluck("account_id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		var result *InterestResult
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if result, err = accrueAccount(tx, id, through, tiersByCurrency); err != nil {
+				return err
+			}
+			if dryRun {
+				return errDryRun
+			}
+			return nil
+		})
+		// one account failing doesn't hold up the others
+		if err != nil && !errors.Is(err, errDryRun) {
+			log.Printf("interest: account %d: %v", id, err)
+			report.Failed = append(report.Failed, InterestFailure{AccountID: id, Error: err.Error()})
+			continue
+		}
+
+		if result != nil && result.Days > 0 {
+			if dryRun {
+				result.Reference = ""
+			}
+			report.Accounts = append(report.Accounts, *result)
+		}
+	}
+
+	return &report, nil
+}
+
+// accrueAccount brings one account's accrual up to through. It must run
+// inside tx.
+func accrueAccount(tx *gorm.DB, accountID int64, through time.Time, tiersByCurrency map[string][]model.InterestTier) (*InterestResult, error) {
+	// the account lock keeps two workers from accruing the same days
+	accounts, err := lockAccounts(tx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	account := accounts[accountID]
+
+	accrual := model.InterestAccrual{}
+	result := tx.Where("account_id = ?", accountID).Limit(1).Find(&accrual)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	// an account accrues from the first day the job sees it
+	previous := through.AddDate(0, 0, -1)
+	accrued := new(big.Rat)
+	if result.RowsAffected > 0 {
+		previous = time.Date(accrual.AccruedThrough.Year(), accrual.AccruedThrough.Month(), accrual.AccruedThrough.Day(), 0, 0, 0, 0, through.Location())
+		if _, ok := accrued.SetString(accrual.Accrued); !ok {
+			return nil, errors.New("invalid accrued interest " + accrual.Accrued)
+		}
+	}
+
+	// rounded, since a day with a daylight saving change isn't 24 hours
+	days := int(through.Sub(previous).Hours()/24 + 0.5)
+	if days <= 0 {
+		return nil, nil
+	}
+
+	interest := new(big.Rat)
+	tiers := tiersByCurrency[account.Currency]
+	if account.Balance > 0 && len(tiers) > 0 {
+		daily, err := dailyInterest(tiers, account.Balance, through)
+		if err != nil {
+			return nil, err
+		}
+		interest.Mul(daily, new(big.Rat).SetInt64(int64(days)))
+	}
+	accrued.Add(accrued, interest)
+
+	res := InterestResult{
+		AccountID: accountID,
+		Currency:  account.Currency,
+		Balance:   account.Balance,
+		Days:      days,
+		Interest:  interest.FloatString(6),
+	}
+
+	// post once a month end has been accrued. A frozen account keeps
+	// accruing and is paid at the first month end after it is active again.
+	monthEnd := startOfMonth(through.AddDate(0, 0, 1)).AddDate(0, 0, -1)
+	if monthEnd.After(previous) && account.Status == accountActive {
+		whole := new(big.Int).Quo(accrued.Num(), accrued.Denom())
+		if whole.Sign() > 0 {
+			_, reference, _, err := creditFunds(tx, categoryInterest, accountID, whole.Int64())
+			if err != nil {
+				return nil, err
+			}
+			accrued.Sub(accrued, new(big.Rat).SetInt(whole))
+			res.Posted = whole.Int64()
+			res.Reference = reference
+		}
+	}
+	res.Accrued = accrued.FloatString(6)
+
+	accrual = model.InterestAccrual{
+		AccountID:      accountID,
+		Accrued:        accrued.RatString(),
+		AccruedThrough: through,
+		UpdatedAt:      time.Now(),
+	}
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "account_id"}},
+		UpdateAll: true,
+	}).Create(&accrual).Error; err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
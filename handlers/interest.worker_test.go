@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"example/model"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestDailyInterest(t *testing.T) {
+	tiers := []model.InterestTier{
+		{Currency: "IDR", MinBalance: 0, AnnualRate: "0.01"},
+		{Currency: "IDR", MinBalance: 1000000, AnnualRate: "0.02"},
+		{Currency: "IDR", MinBalance: 5000000, AnnualRate: "0.03"},
+	}
+	march := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// balances are picked so the yearly interest reads off easily; the
+	// expected values are a 365th of it
+	cases := map[string]struct {
+		balance int64
+		yearly  string
+	}{
+		"nothing below zero":          {-5000, "0"},
+		"an empty account":            {0, "0"},
+		"inside the first band":       {365000, "3650"},
+		"exactly on a tier boundary":  {1000000, "10000"},
+		"one unit into the next band": {1000001, "1000002/100"},
+		"through the middle band":     {3000000, "50000"},
+		"into the top band":           {6000000, "120000"},
+	}
+
+	for name, c := range cases {
+		yearly, _ := new(big.Rat).SetString(c.yearly)
+		want := yearly.Quo(yearly, big.NewRat(365, 1))
+
+		got, err := dailyInterest(tiers, c.balance, march)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got.Cmp(want) != 0 {
+			t.Errorf("%s: dailyInterest(%d) = %s, want %s", name, c.balance, got.RatString(), want.RatString())
+		}
+	}
+}
+
+func TestDailyInterestLeapYear(t *testing.T) {
+	tiers := []model.InterestTier{{Currency: "IDR", AnnualRate: "0.01"}}
+
+	common, _ := dailyInterest(tiers, 366000, time.Date(2025, 2, 28, 0, 0, 0, 0, time.UTC))
+	leap, _ := dailyInterest(tiers, 366000, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC))
+
+	if want := big.NewRat(3660, 365); common.Cmp(want) != 0 {
+		t.Errorf("2025 day = %s, want %s", common.RatString(), want.RatString())
+	}
+	if want := big.NewRat(10, 1); leap.Cmp(want) != 0 {
+		t.Errorf("2024 day = %s, want %s", leap.RatString(), want.RatString())
+	}
+}
+
+func TestDailyInterestInvalidRate(t *testing.T) {
+	tiers := []model.InterestTier{
+		{Currency: "IDR", MinBalance: 0, AnnualRate: "0.01"},
+		{Currency: "IDR", MinBalance: 1000, AnnualRate: "2%"},
+	}
+
+	if _, err := dailyInterest(tiers, 500, time.Now()); err != nil {
+		t.Errorf("a balance below the bad tier failed: %v", err)
+	}
+	if _, err := dailyInterest(tiers, 5000, time.Now()); err == nil {
+		t.Error("a balance reaching the bad tier was accrued")
+	}
+}
+
+// TestAccrueAccountCarriesFraction accrues an account over a month end. Only
+// whole units are posted, and the fraction is kept for the next month.
+func TestAccrueAccountCarriesFraction(t *testing.T) {
+	db := testDB(t)
+
+	defer SetHouseAccount(houseAccountID)
+	SetHouseAccount(0)
+
+	accountID := openTestAccount(t, db, "IDR", 100000)
+	t.Cleanup(func() {
+		db.Where("account_id = ?", accountID).Delete(&model.InterestAccrual{})
+	})
+	tiers := map[string][]model.InterestTier{
+		"IDR": {{Currency: "IDR", AnnualRate: "0.01"}},
+	}
+
+	// 100000 at 1% earns 1000/365 a day
+	for day := 30; day <= 31; day++ {
+		tx := db.Begin()
+		result, err := accrueAccount(tx, accountID, time.Date(2025, 1, day, 0, 0, 0, 0, time.UTC), tiers)
+		if err != nil {
+			tx.Rollback()
+			t.Fatal(err)
+		}
+		if err := tx.Commit().Error; err != nil {
+			t.Fatal(err)
+		}
+
+		if day == 30 && result.Posted != 0 {
+			t.Errorf("posted %d before the month end", result.Posted)
+		}
+		if day == 31 && result.Posted != 5 {
+			t.Errorf("posted %d at the month end, want 5", result.Posted)
+		}
+	}
+
+	accrual := model.InterestAccrual{}
+	if err := db.Where("account_id = ?", accountID).First(&accrual).Error; err != nil {
+		t.Fatal(err)
+	}
+	if accrual.Accrued != "35/73" {
+		t.Errorf("carried %s, want 35/73", accrual.Accrued)
+	}
+
+	account := model.Account{}
+	if err := db.First(&account, accountID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if account.Balance != 100005 {
+		t.Errorf("balance is %d, want 100005", account.Balance)
+	}
+}
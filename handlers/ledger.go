@@ -0,0 +1,643 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"example/model"
+	"example/utils"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Names of the transaction categories used by the ledger.
+const (
+	categoryTopUp      = "topup"
+	categoryTransfer   = "transfer"
+	categoryReversal   = "reversal"
+	categoryCapture    = "capture"
+	categoryAdjustment = "adjustment"
+	categoryWithdrawal = "withdrawal"
+	categoryFee        = "fee"
+	categoryPocket     = "pocket"
+	categoryInterest   = "interest"
+)
+
+// systemCategories are seeded at startup so every ledger category exists
+// before the first money movement.
+var systemCategories = []string{
+	categoryTopUp,
+	categoryTransfer,
+	categoryWithdrawal,
+	categoryFee,
+	categoryAdjustment,
+	categoryReversal,
+	categoryCapture,
+	categoryPocket,
+	categoryInterest,
+}
+
+var (
+	errAccountNotFound     = errors.New("Data not found")
+	errInsufficientBalance = errors.New("Balance not enough")
+	errInvalidAmount       = errors.New("amount must be greater than zero")
+	errSameAccount         = errors.New("cannot transfer to the same account")
+	errNotReversible       = errors.New("only transfers can be reversed")
+	errAlreadyReversed     = errors.New("transaction is already fully reversed")
+	errRefundTooLarge      = errors.New("refund exceeds the remaining amount of the transaction")
+	errNoExchangeRate      = errors.New("no exchange rate available for this currency pair")
+	errHoldNotActive       = errors.New("hold is no longer active")
+	errCaptureTooLarge     = errors.New("capture exceeds the held amount")
+	errAccountInactive     = errors.New("account is not active")
+	errCurrencyMismatch    = errors.New("accounts must hold the same currency")
+)
+
+// transferResult holds both accounts after a transfer, the amount debited in
+// the sender's currency, the amount credited in the recipient's currency and
+// the reference of the journal entries written for it. ExchangeRate is only
+// set for cross-currency transfers and Fee only when a fee rule applied.
+type transferResult struct {
+	Sender         model.Account
+	Recipient      model.Account
+	Amount         int64
+	CreditedAmount int64
+	ExchangeRate   *string
+	Reference      string
+	Fee            *model.FeeCharge
+}
+
+// abortWithLedgerError maps the errors returned by the ledger helpers to an
+// HTTP response.
+func abortWithLedgerError(ctx *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errAccountNotFound), errors.Is(err, errPocketNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errInsufficientBalance):
+		status = http.StatusNotAcceptable
+	case errors.Is(err, errAccountInactive):
+		status = http.StatusForbidden
+	case errors.Is(err, errInvalidAmount), errors.Is(err, errSameAccount),
+		errors.Is(err, errNotReversible), errors.Is(err, errRefundTooLarge),
+		errors.Is(err, errCaptureTooLarge), errors.Is(err, errCurrencyMismatch):
+		status = http.StatusBadRequest
+	case errors.Is(err, errAlreadyReversed), errors.Is(err, errHoldNotActive),
+		errors.Is(err, errStatusTransition), errors.Is(err, errAccountNotEmpty),
+		errors.Is(err, errRequestNotPending):
+		status = http.StatusConflict
+	case errors.Is(err, errNoExchangeRate), errors.Is(err, errLimitExceeded):
+		status = http.StatusUnprocessableEntity
+	}
+
+	ctx.AbortWithStatusJSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
+
+// lockAccounts loads the given accounts with SELECT ... FOR UPDATE. Rows are
+// always locked in ascending account_id order, so two transfers touching the
+// same pair of accounts in opposite directions cannot deadlock.
+func lockAccounts(tx *gorm.DB, ids ...int64) (map[int64]*model.Account, error) {
+	sorted := make([]int64, 0, len(ids))
+	seen := map[int64]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			sorted = append(sorted, id)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var accounts []model.Account
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("account_id IN ?", sorted).
+		Order("account_id").
+		Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+
+	if len(accounts) != len(sorted) {
+		return nil, errAccountNotFound
+	}
+
+	locked := make(map[int64]*model.Account, len(accounts))
+	for i := range accounts {
+		locked[accounts[i].AccountID] = &accounts[i]
+	}
+
+	return locked, nil
+}
+
+// addBalance atomically adds delta to the balance of a locked account and
+// keeps the in-memory copy in sync.
+func addBalance(tx *gorm.DB, account *model.Account, delta int64) error {
+	if err := tx.Model(&model.Account{}).
+		Where("account_id = ?", account.AccountID).
+		UpdateColumn("balance", gorm.Expr("balance + ?", delta)).Error; err != nil {
+		return err
+	}
+
+	account.Balance += delta
+	return nil
+}
+
+// transferFunds moves amount from one account to another and journals it
+// under the given category with memo on both entries, enforcing the
+// sender's available balance and transfer limits. Plain transfers also pay
+// the transfer fee, which has to fit in the available balance next to
+// amount. It must run inside tx; nothing is committed.
+func transferFunds(tx *gorm.DB, category string, fromID, toID, amount int64, memo string) (*transferResult, error) {
+	return transferAtRate(tx, category, fromID, toID, amount, nil, memo)
+}
+
+// transferAtRate is transferFunds converting at the given rate instead of
+// the current one. A nil rate uses the current one.
+func transferAtRate(tx *gorm.DB, category string, fromID, toID, amount int64, rate *big.Rat, memo string) (*transferResult, error) {
+	if amount <= 0 {
+		return nil, errInvalidAmount
+	}
+	if fromID == toID {
+		return nil, errSameAccount
+	}
+
+	// the house account is locked with the others so fee postings keep the
+	// ascending lock order
+	charged := category == categoryTransfer
+	ids := []int64{fromID, toID}
+	if charged && houseAccountID != 0 {
+		ids = append(ids, houseAccountID)
+	}
+
+	accounts, err := lockAccounts(tx, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	sender, recipient := accounts[fromID], accounts[toID]
+	if err := checkActive(sender, recipient); err != nil {
+		return nil, err
+	}
+
+	quote := &feeQuote{}
+	if charged {
+		if quote, err = quoteFee(tx, sender, limitTransfer, amount, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkAvailable(tx, sender, amount+quote.Fee); err != nil {
+		return nil, err
+	}
+	if err := checkLimits(tx, sender, limitTransfer, amount); err != nil {
+		return nil, err
+	}
+
+	var credit int64
+	var rateText *string
+	if rate == nil {
+		credit, rateText, err = convertFunds(tx, sender.Currency, recipient.Currency, amount)
+	} else {
+		credit, rateText, err = convertAtRate(sender.Currency, recipient.Currency, amount, rate)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := addBalance(tx, sender, -amount); err != nil {
+		return nil, err
+	}
+	if err := addBalance(tx, recipient, credit); err != nil {
+		return nil, err
+	}
+
+	reference, err := recordTransfer(tx, category, sender, recipient, amount, credit, rateText, memo)
+	if err != nil {
+		return nil, err
+	}
+
+	fee, err := postFee(tx, sender, accounts[houseAccountID], quote, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transferResult{
+		Sender:         *sender,
+		Recipient:      *recipient,
+		Amount:         amount,
+		CreditedAmount: credit,
+		ExchangeRate:   rateText,
+		Reference:      reference,
+		Fee:            fee,
+	}, nil
+}
+
+// convertFunds converts amount between currencies at the current rate,
+// rounding down. The rate is only returned when the currencies differ.
+func convertFunds(tx *gorm.DB, from, to string, amount int64) (int64, *string, error) {
+	if from == to {
+		return amount, nil, nil
+	}
+
+	rate, err := exchangeRate(tx, from, to)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return convertAtRate(from, to, amount, rate)
+}
+
+// convertAtRate converts amount between currencies at rate, rounding down.
+// The rate is only returned when the currencies differ.
+func convertAtRate(from, to string, amount int64, rate *big.Rat) (int64, *string, error) {
+	if from == to {
+		return amount, nil, nil
+	}
+
+	converted := utils.ConvertAmount(amount, rate, from, to)
+	if converted <= 0 {
+		return 0, nil, errInvalidAmount
+	}
+
+	text := rate.FloatString(10)
+	return converted, &text, nil
+}
+
+// heldAmount returns the part of an account's balance reserved by active,
+// unexpired holds.
+func heldAmount(db *gorm.DB, accountID int64) (int64, error) {
+	var held int64
+	err := db.Model(&model.Hold{}).
+		Where("account_id = ? AND status = ? AND expires_at > ?", accountID, holdActive, time.Now()).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&held).Error
+
+	return held, err
+}
+
+// pocketedAmount returns the part of an account's balance set aside in its
+// pockets.
+func pocketedAmount(db *gorm.DB, accountID int64) (int64, error) {
+	var pocketed int64
+	err := db.Model(&model.Pocket{}).
+		Where("account_id = ?", accountID).
+		Select("COALESCE(SUM(balance), 0)").
+		Scan(&pocketed).Error
+
+	return pocketed, err
+}
+
+// checkAvailable fails with errInsufficientBalance when amount is more than
+// the locked account's balance minus its holds and pockets.
+func checkAvailable(tx *gorm.DB, account *model.Account, amount int64) error {
+	held, err := heldAmount(tx, account.AccountID)
+	if err != nil {
+		return err
+	}
+	pocketed, err := pocketedAmount(tx, account.AccountID)
+	if err != nil {
+		return err
+	}
+
+	if account.Balance-held-pocketed < amount {
+		return errInsufficientBalance
+	}
+	return nil
+}
+
+// checkActive fails with errAccountInactive when one of the locked accounts
+// is frozen or closed.
+func checkActive(accounts ...*model.Account) error {
+	for _, account := range accounts {
+		if account.Status != accountActive {
+			return fmt.Errorf("account %d is %s: %w", account.AccountID, account.Status, errAccountInactive)
+		}
+	}
+	return nil
+}
+
+// exchangeRate returns the rate for converting from one currency to another.
+// A rate stored for the opposite direction is inverted.
+func exchangeRate(tx *gorm.DB, from, to string) (*big.Rat, error) {
+	rate := model.ExchangeRate{}
+	result := tx.Where("base_currency = ? AND quote_currency = ?", from, to).Limit(1).Find(&rate)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return utils.ParseRate(rate.Rate)
+	}
+
+	result = tx.Where("base_currency = ? AND quote_currency = ?", to, from).Limit(1).Find(&rate)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errNoExchangeRate
+	}
+
+	inverse, err := utils.ParseRate(rate.Rate)
+	if err != nil {
+		return nil, err
+	}
+	return inverse.Inv(inverse), nil
+}
+
+// reverseTransfer moves up to the original amount of the transfer with the
+// given reference back from the recipient to the sender. An amount of zero
+// refunds whatever has not been refunded yet. The compensating entries point
+// back to the original through ReversalOf. It must run inside tx.
+func reverseTransfer(tx *gorm.DB, reference string, amount int64) (*transferResult, error) {
+	// locking the original entries serializes concurrent refunds of the same
+	// transfer, so the remaining amount below can't be read twice
+	var entries []model.Transaction
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("reference = ?", reference).
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	var credit *model.Transaction
+	for i := range entries {
+		if entries[i].Amount > 0 {
+			credit = &entries[i]
+		}
+	}
+	if credit == nil || credit.FromAccountID == nil || credit.ToAccountID == nil || credit.ReversalOf != nil {
+		return nil, errNotReversible
+	}
+
+	// a pocket move has the same account on both ends
+	if credit.Kind == categoryPocket || *credit.FromAccountID == *credit.ToAccountID {
+		return nil, errNotReversible
+	}
+
+	// a cross-currency transfer is refunded at the rate it was made at, so
+	// the sender gets back what they paid and not what it is worth today
+	var rate *big.Rat
+	if credit.ExchangeRate != nil {
+		original, err := utils.ParseRate(*credit.ExchangeRate)
+		if err != nil {
+			return nil, err
+		}
+		rate = original.Inv(original)
+	}
+
+	// refunds are counted on the recipient's side, in the same currency as
+	// the credit they are taken from
+	var refunded int64
+	if err := tx.Model(&model.Transaction{}).
+		Where("reversal_of = ? AND account_id = ? AND amount < 0", reference, credit.AccountID).
+		Select("COALESCE(SUM(-amount), 0)").
+		Scan(&refunded).Error; err != nil {
+		return nil, err
+	}
+
+	remaining := credit.Amount - refunded
+	if remaining <= 0 {
+		return nil, errAlreadyReversed
+	}
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount > remaining {
+		return nil, errRefundTooLarge
+	}
+
+	result, err := transferAtRate(tx, categoryReversal, *credit.ToAccountID, *credit.FromAccountID, amount, rate, "Reversal of "+reference)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(&model.Transaction{}).
+		Where("reference = ?", result.Reference).
+		Update("reversal_of", reference).Error; err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// debitFunds takes money out of the bank from an account and journals it
+// under the given category. It applies the same available balance and
+// transfer limit checks as transferFunds. It must run inside tx.
+func debitFunds(tx *gorm.DB, category string, accountID, amount int64) (*model.Account, string, error) {
+	if amount <= 0 {
+		return nil, "", errInvalidAmount
+	}
+
+	accounts, err := lockAccounts(tx, accountID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	account := accounts[accountID]
+	if err := checkActive(account); err != nil {
+		return nil, "", err
+	}
+	if err := checkAvailable(tx, account, amount); err != nil {
+		return nil, "", err
+	}
+	if err := checkLimits(tx, account, limitTransfer, amount); err != nil {
+		return nil, "", err
+	}
+
+	if err := addBalance(tx, account, -amount); err != nil {
+		return nil, "", err
+	}
+
+	reference, err := recordDebit(tx, category, account, amount)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return account, reference, nil
+}
+
+// creditFunds adds money coming from outside the bank to an account and
+// journals it under the given category. Top-ups are checked against the
+// account's top-up limits and pay the top-up fee out of the credited money.
+// It must run inside tx.
+func creditFunds(tx *gorm.DB, category string, accountID, amount int64) (*model.Account, string, *model.FeeCharge, error) {
+	if amount <= 0 {
+		return nil, "", nil, errInvalidAmount
+	}
+
+	charged := category == categoryTopUp
+	ids := []int64{accountID}
+	if charged && houseAccountID != 0 {
+		ids = append(ids, houseAccountID)
+	}
+
+	accounts, err := lockAccounts(tx, ids...)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	account := accounts[accountID]
+	if err := checkActive(account); err != nil {
+		return nil, "", nil, err
+	}
+
+	quote := &feeQuote{}
+	if charged {
+		if err := checkLimits(tx, account, limitTopUp, amount); err != nil {
+			return nil, "", nil, err
+		}
+		if quote, err = quoteFee(tx, account, limitTopUp, amount, time.Now()); err != nil {
+			return nil, "", nil, err
+		}
+	}
+
+	if err := addBalance(tx, account, amount); err != nil {
+		return nil, "", nil, err
+	}
+
+	reference, err := recordCredit(tx, category, account, amount)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	// a minimum fee can be more than a small top-up brings in
+	if err := checkAvailable(tx, account, quote.Fee); err != nil {
+		return nil, "", nil, err
+	}
+	fee, err := postFee(tx, account, accounts[houseAccountID], quote, reference)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return account, reference, fee, nil
+}
+
+// categoryID returns the id of the system transaction category with the
+// given name, creating the category on first use.
+func categoryID(tx *gorm.DB, name string) (int64, error) {
+	category := model.TransactionCategory{}
+	if err := tx.Where("name = ? AND account_id IS NULL", name).FirstOrCreate(&category, model.TransactionCategory{Name: name}).Error; err != nil {
+		return 0, err
+	}
+
+	return category.TransactionCategoryID, nil
+}
+
+// newReference returns a reference number shared by every entry of one money
+// movement, e.g. TRX20241018A1B2C3D4.
+func newReference(now time.Time) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("TRX%s%s", now.Format("20060102"), strings.ToUpper(hex.EncodeToString(b))), nil
+}
+
+// postEntries writes the entries of a single money movement to the
+// transaction table. Every entry gets the same date and reference so the
+// movement can be read back as one unit, and the given category. Transfer
+// entries may be filed elsewhere by their account's rules; every other
+// category is the ledger's own and is kept. It must be called with the same
+// tx that changes the account balances.
+func postEntries(tx *gorm.DB, category string, entries []model.Transaction) (string, error) {
+	id, err := categoryID(tx, category)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	reference, err := newReference(now)
+	if err != nil {
+		return "", err
+	}
+
+	for i := range entries {
+		entries[i].TransactionCategoryID = id
+		entries[i].Kind = category
+		entries[i].Reference = reference
+		entries[i].TransactionDate = now
+	}
+
+	// the owner's categorization rules may file a transfer elsewhere
+	if category == categoryTransfer {
+		if err := applyRules(tx, entries); err != nil {
+			return "", err
+		}
+	}
+
+	if err := tx.Create(&entries).Error; err != nil {
+		return "", err
+	}
+
+	if err := checkBudgets(tx, entries); err != nil {
+		return "", err
+	}
+
+	return reference, nil
+}
+
+// recordTransfer journals a transfer as a debit on the sender and a matching
+// credit on the recipient, each in its account's currency. Within one
+// currency the two entries sum to zero; across currencies they are linked by
+// the recorded rate.
+func recordTransfer(tx *gorm.DB, category string, sender, recipient *model.Account, debit, credit int64, rate *string, memo string) (string, error) {
+	fromID, toID := sender.AccountID, recipient.AccountID
+	return postEntries(tx, category, []model.Transaction{
+		{AccountID: fromID, FromAccountID: &fromID, ToAccountID: &toID, Amount: -debit, Currency: sender.Currency, ExchangeRate: rate, Memo: memo},
+		{AccountID: toID, FromAccountID: &fromID, ToAccountID: &toID, Amount: credit, Currency: recipient.Currency, ExchangeRate: rate, Memo: memo},
+	})
+}
+
+// recordDebit journals money leaving the bank from an account, such as a
+// withdrawal. The entry has no to account.
+func recordDebit(tx *gorm.DB, category string, account *model.Account, amount int64) (string, error) {
+	accountID := account.AccountID
+	return postEntries(tx, category, []model.Transaction{
+		{AccountID: accountID, FromAccountID: &accountID, Amount: -amount, Currency: account.Currency},
+	})
+}
+
+// recordAdjustment journals a correction that brings the ledger in line with
+// the account balance. It has neither a from nor a to account, always stays
+// in the adjustment category and counts toward no limit.
+func recordAdjustment(tx *gorm.DB, account *model.Account, amount int64) (string, error) {
+	return postEntries(tx, categoryAdjustment, []model.Transaction{
+		{AccountID: account.AccountID, Amount: amount, Currency: account.Currency},
+	})
+}
+
+// recordPocketMove journals money moving between an account's main balance
+// and one of its pockets as two entries on the account that sum to zero. A
+// positive amount moves money into the pocket.
+func recordPocketMove(tx *gorm.DB, account *model.Account, pocketID, amount int64) (string, error) {
+	accountID := account.AccountID
+	return postEntries(tx, categoryPocket, []model.Transaction{
+		{AccountID: accountID, FromAccountID: &accountID, ToAccountID: &accountID, Amount: -amount, Currency: account.Currency},
+		{AccountID: accountID, FromAccountID: &accountID, ToAccountID: &accountID, PocketID: &pocketID, Amount: amount, Currency: account.Currency},
+	})
+}
+
+// recordCredit journals money entering an account from outside the bank,
+// such as a top-up. The entry has no from account.
+func recordCredit(tx *gorm.DB, category string, account *model.Account, amount int64) (string, error) {
+	accountID := account.AccountID
+	return postEntries(tx, category, []model.Transaction{
+		{AccountID: accountID, ToAccountID: &accountID, Amount: amount, Currency: account.Currency},
+	})
+}
+
+// expiresIn turns an expires_in payload field in seconds into a duration,
+// falling back to def when it is zero. Payloads cap the field at 90 days
+// (7776000 seconds) with a binding tag so the conversion can't overflow.
+func expiresIn(seconds int64, def time.Duration) time.Duration {
+	if seconds <= 0 {
+		return def
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"errors"
+	"example/model"
+	"math/rand"
+	"os"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB connects to the database in TEST_POSTGRESQL, which must have the
+// schema of database/table.ddl.sql. Tests that need it are skipped without.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_POSTGRESQL")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRESQL is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// openTestAccount opens an account in currency and tops it up with balance
+// through the ledger, so its journal matches its balance from the start. The
+// account and its entries are removed when the test ends.
+func openTestAccount(t *testing.T, db *gorm.DB, currency string, balance int64) int64 {
+	t.Helper()
+
+	account := model.Account{Name: "ledger test " + t.Name(), Currency: currency}
+	if err := db.Create(&account).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Where("account_id = ?", account.AccountID).Delete(&model.Transaction{})
+		db.Delete(&model.Account{}, account.AccountID)
+	})
+
+	if balance > 0 {
+		tx := db.Begin()
+		if _, _, _, err := creditFunds(tx, categoryTopUp, account.AccountID, balance); err != nil {
+			tx.Rollback()
+			t.Fatal(err)
+		}
+		if err := tx.Commit().Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return account.AccountID
+}
+
+// TestTransferFundsConcurrent runs transfers between a few accounts from many
+// goroutines at once. Whatever fails, the money must neither appear nor
+// vanish, no balance may go negative and every balance must match its
+// journal entries.
+func TestTransferFundsConcurrent(t *testing.T) {
+	const (
+		accountCount   = 5
+		workers        = 8
+		transfersEach  = 50
+		openingBalance = 100000
+	)
+
+	db := testDB(t)
+
+	// fees move money to the house account, outside the accounts checked
+	defer SetHouseAccount(houseAccountID)
+	SetHouseAccount(0)
+
+	ids := make([]int64, accountCount)
+	for n := range ids {
+		ids[n] = openTestAccount(t, db, "IDR", openingBalance)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			random := rand.New(rand.NewSource(seed))
+
+			for i := 0; i < transfersEach; i++ {
+				from := ids[random.Intn(accountCount)]
+				to := ids[random.Intn(accountCount)]
+				for to == from {
+					to = ids[random.Intn(accountCount)]
+				}
+				amount := random.Int63n(30000) + 1
+
+				tx := db.Begin()
+				_, err := transferFunds(tx, categoryTransfer, from, to, amount, "ledger test")
+				if err != nil {
+					tx.Rollback()
+					if !errors.Is(err, errInsufficientBalance) && !errors.Is(err, errLimitExceeded) {
+						t.Errorf("transfer %d -> %d of %d: %v", from, to, amount, err)
+					}
+					continue
+				}
+				if err := tx.Commit().Error; err != nil {
+					t.Errorf("commit %d -> %d of %d: %v", from, to, amount, err)
+				}
+			}
+		}(int64(w))
+	}
+	wg.Wait()
+
+	var accounts []model.Account
+	if err := db.Where("account_id IN ?", ids).Find(&accounts).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var total int64
+	for _, account := range accounts {
+		total += account.Balance
+		if account.Balance < 0 {
+			t.Errorf("account %d has a negative balance %d", account.AccountID, account.Balance)
+		}
+
+		var journaled int64
+		if err := db.Model(&model.Transaction{}).
+			Where("account_id = ?", account.AccountID).
+			Select("COALESCE(SUM(amount), 0)").
+			Scan(&journaled).Error; err != nil {
+			t.Fatal(err)
+		}
+		if journaled != account.Balance {
+			t.Errorf("account %d has balance %d but its entries add up to %d", account.AccountID, account.Balance, journaled)
+		}
+	}
+
+	if want := int64(accountCount * openingBalance); total != want {
+		t.Errorf("total balance is %d, want %d", total, want)
+	}
+}
+
+// TestReverseTransferConverted refunds a USD to IDR transfer in two parts
+// after the rate has moved. Both parts are taken from the IDR credit and
+// paid back at the original rate, and nothing is left to refund after.
+func TestReverseTransferConverted(t *testing.T) {
+	db := testDB(t)
+
+	defer SetHouseAccount(houseAccountID)
+	SetHouseAccount(0)
+
+	setRate := func(rate string) {
+		t.Helper()
+		if _, err := upsertExchangeRate(db, exchangeRatePayload{BaseCurrency: "USD", QuoteCurrency: "IDR", Rate: rate}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setRate("15000")
+	t.Cleanup(func() {
+		db.Where("base_currency = ? AND quote_currency = ?", "USD", "IDR").Delete(&model.ExchangeRate{})
+	})
+
+	sender := openTestAccount(t, db, "USD", 10000)
+	recipient := openTestAccount(t, db, "IDR", 0)
+
+	commit := func(run func(tx *gorm.DB) (*transferResult, error)) (*transferResult, error) {
+		t.Helper()
+		tx := db.Begin()
+		result, err := run(tx)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		return result, tx.Commit().Error
+	}
+	balance := func(accountID int64) int64 {
+		t.Helper()
+		account := model.Account{}
+		if err := db.First(&account, accountID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return account.Balance
+	}
+
+	transfer, err := commit(func(tx *gorm.DB) (*transferResult, error) {
+		return transferFunds(tx, categoryTransfer, sender, recipient, 10000, "converted")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transfer.CreditedAmount != 1500000 {
+		t.Fatalf("$100.00 was credited as %d IDR, want 1500000", transfer.CreditedAmount)
+	}
+
+	// today's rate must not matter for the refund
+	setRate("16000")
+
+	reverse := func(amount int64) (*transferResult, error) {
+		return commit(func(tx *gorm.DB) (*transferResult, error) {
+			return reverseTransfer(tx, transfer.Reference, amount)
+		})
+	}
+
+	if _, err := reverse(750000); err != nil {
+		t.Fatalf("first refund: %v", err)
+	}
+	if got := balance(sender); got != 5000 {
+		t.Errorf("sender has %d after refunding half, want 5000", got)
+	}
+
+	if _, err := reverse(750001); !errors.Is(err, errRefundTooLarge) {
+		t.Errorf("refunding more than the rest returned %v, want errRefundTooLarge", err)
+	}
+
+	if _, err := reverse(0); err != nil {
+		t.Fatalf("second refund: %v", err)
+	}
+	if got := balance(sender); got != 10000 {
+		t.Errorf("sender has %d after the full refund, want 10000", got)
+	}
+	if got := balance(recipient); got != 0 {
+		t.Errorf("recipient has %d after the full refund, want 0", got)
+	}
+
+	if _, err := reverse(0); !errors.Is(err, errAlreadyReversed) {
+		t.Errorf("third refund returned %v, want errAlreadyReversed", err)
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"example/model"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Operations limits and fees are configured for. Transfer limits count the
+// account's transfers, withdrawals and captured holds, top-up limits count
+// its top-ups.
+const (
+	limitTransfer = "transfer"
+	limitTopUp    = "topup"
+)
+
+var errLimitExceeded = errors.New("limit exceeded")
+
+// limitUsage is how much of its daily and monthly allowance an account has
+// used for one operation.
+type limitUsage struct {
+	DailyTotal   int64
+	DailyCount   int64
+	MonthlyTotal int64
+}
+
+// limitRemaining reports a limit next to what is still left of it. A nil
+// Remaining means unlimited.
+type limitRemaining struct {
+	Limit     int64  `json:"limit"`
+	Remaining *int64 `json:"remaining"`
+}
+
+func newLimitRemaining(limit, used int64) limitRemaining {
+	if limit == 0 {
+		return limitRemaining{}
+	}
+
+	remaining := max(limit-used, 0)
+	return limitRemaining{Limit: limit, Remaining: &remaining}
+}
+
+// startOfDay and startOfMonth bound the limit periods in server local time.
+func startOfDay(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
+
+func startOfMonth(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+}
+
+// accountLimit returns the limits of the account's tier for an operation in
+// the account's currency. Without a configured row the operation is
+// unlimited.
+func accountLimit(db *gorm.DB, account *model.Account, operation string) (*model.LimitTier, error) {
+	limit := model.LimitTier{Tier: account.Tier, Operation: operation, Currency: account.Currency}
+	if err := db.Where("tier = ? AND operation = ? AND currency = ?", account.Tier, operation, account.Currency).Limit(1).Find(&limit).Error; err != nil {
+		return nil, err
+	}
+	return &limit, nil
+}
+
+// usage sums the account's entries counting toward an operation's limits
+// since the start of the current month.
+func usage(db *gorm.DB, accountID int64, operation string, now time.Time) (*limitUsage, error) {
+	query := db.Model(&model.Transaction{}).
+		Where("account_id = ? AND transaction_date >= ?", accountID, startOfMonth(now))
+	// entries are counted by the kind they were posted as, so refiling one
+	// under another category doesn't take it out of its limits. Fees,
+	// refunds and adjustments count toward none.
+	if operation == limitTopUp {
+		query = query.Where("amount > 0 AND kind = ?", categoryTopUp)
+	} else {
+		query = query.Where("amount < 0 AND kind IN ?", []string{categoryTransfer, categoryWithdrawal, categoryCapture})
+	}
+
+	used := limitUsage{}
+	err := query.Select(
+		"COALESCE(SUM(ABS(amount)) FILTER (WHERE transaction_date >= ?), 0) AS daily_total, "+
+			"COUNT(*) FILTER (WHERE transaction_date >= ?) AS daily_count, "+
+			"COALESCE(SUM(ABS(amount)), 0) AS monthly_total",
+		startOfDay(now), startOfDay(now),
+	).Scan(&used).Error
+
+	return &used, err
+}
+
+// checkLimits fails with errLimitExceeded when amount would take the account
+// over one of its limits for the operation. The account must be locked by tx
+// so concurrent requests can't both pass the check.
+func checkLimits(tx *gorm.DB, account *model.Account, operation string, amount int64) error {
+	limit, err := accountLimit(tx, account, operation)
+	if err != nil {
+		return err
+	}
+
+	if limit.PerTransactionMax > 0 && amount > limit.PerTransactionMax {
+		return fmt.Errorf("%w: %s per transaction maximum is %d", errLimitExceeded, operation, limit.PerTransactionMax)
+	}
+
+	used, err := usage(tx, account.AccountID, operation, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if limit.DailyTotal > 0 && used.DailyTotal+amount > limit.DailyTotal {
+		return fmt.Errorf("%w: %s daily total is %d", errLimitExceeded, operation, limit.DailyTotal)
+	}
+	if limit.MonthlyTotal > 0 && used.MonthlyTotal+amount > limit.MonthlyTotal {
+		return fmt.Errorf("%w: %s monthly total is %d", errLimitExceeded, operation, limit.MonthlyTotal)
+	}
+	if limit.DailyCount > 0 && used.DailyCount+1 > limit.DailyCount {
+		return fmt.Errorf("%w: %s daily count is %d", errLimitExceeded, operation, limit.DailyCount)
+	}
+
+	return nil
+}
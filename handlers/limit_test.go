@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"example/model"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestTransferLimitCountsCaptures spends most of a daily transfer limit by
+// having a merchant capture a hold, then checks that the transfer limit has
+// been used up by it.
+func TestTransferLimitCountsCaptures(t *testing.T) {
+	db := testDB(t)
+	gin.SetMode(gin.TestMode)
+
+	defer SetHouseAccount(houseAccountID)
+	SetHouseAccount(0)
+
+	const tier = "limit-test"
+	limit := model.LimitTier{Tier: tier, Operation: limitTransfer, Currency: "IDR", DailyTotal: 100000}
+	if err := db.Create(&limit).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Where("tier = ?", tier).Delete(&model.LimitTier{})
+	})
+
+	sender := openTestAccount(t, db, "IDR", 500000)
+	merchant := openTestAccount(t, db, "IDR", 0)
+	friend := openTestAccount(t, db, "IDR", 0)
+	if err := db.Exec("UPDATE account SET tier = ? WHERE account_id = ?", tier, sender).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	hold := model.Hold{
+		AccountID:         sender,
+		MerchantAccountID: merchant,
+		Amount:            80000,
+		Status:            holdActive,
+		ExpiresAt:         time.Now().Add(time.Hour),
+		CreatedAt:         time.Now(),
+	}
+	if err := db.Create(&hold).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/account/hold/"+strconv.FormatInt(hold.HoldID, 10)+"/capture", nil)
+	ctx.Params = gin.Params{{Key: "id", Value: strconv.FormatInt(hold.HoldID, 10)}}
+	ctx.Set("account_id", merchant)
+	NewHold(db).Capture(ctx)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("capture returned %d: %s", recorder.Code, recorder.Body)
+	}
+
+	transfer := func(amount int64) error {
+		tx := db.Begin()
+		if _, err := transferFunds(tx, categoryTransfer, sender, friend, amount, "after capture"); err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit().Error
+	}
+
+	if err := transfer(30000); !errors.Is(err, errLimitExceeded) {
+		t.Errorf("transfer past what the capture left of the limit returned %v, want errLimitExceeded", err)
+	}
+	if err := transfer(20000); err != nil {
+		t.Errorf("transfer within what the capture left of the limit returned %v", err)
+	}
+}
@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"example/model"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Statuses of an invitation to join an account.
+const (
+	invitationPending  = "pending"
+	invitationAccepted = "accepted"
+	invitationDeclined = "declined"
+	invitationRevoked  = "revoked"
+)
+
+type MemberInterface interface {
+	List(*gin.Context)
+	Invite(*gin.Context)
+	Revoke(*gin.Context)
+	Remove(*gin.Context)
+	Accounts(*gin.Context)
+	Invitations(*gin.Context)
+	Accept(*gin.Context)
+	Decline(*gin.Context)
+}
+
+type memberImplement struct {
+	db *gorm.DB
+}
+
+func NewMember(db *gorm.DB) MemberInterface {
+	return &memberImplement{
+		db: db,
+	}
+}
+
+type invitePayload struct {
+	Username string `json:"username" binding:"required"`
+	Role     string `json:"role" binding:"required,oneof=owner spender viewer"`
+}
+
+type memberView struct {
+	AccountID int64     `json:"account_id"`
+	AuthID    int64     `json:"auth_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type membershipView struct {
+	AccountID int64  `json:"account_id"`
+	Name      string `json:"name"`
+	Currency  string `json:"currency"`
+	Status    string `json:"status"`
+	Role      string `json:"role"`
+}
+
+// List returns the members of the account.
+func (m *memberImplement) List(ctx *gin.Context) {
+	var members []memberView
+	accountID := ctx.GetInt64("account_id")
+
+	if err := m.db.Table("account_member").
+		Select("account_member.account_id, account_member.auth_id, auth.username, account_member.role, account_member.created_at").
+		Joins("JOIN auth ON auth.auth_id = account_member.auth_id").
+		Where("account_member.account_id = ?", accountID).
+		Order("account_member.created_at").
+		Scan(&members).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": members,
+	})
+}
+
+// Invite asks another user to join the account with a role. They become a
+// member once they accept.
+func (m *memberImplement) Invite(ctx *gin.Context) {
+	payload := invitePayload{}
+	accountID := ctx.GetInt64("account_id")
+
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	account := model.Account{}
+	if err := m.db.First(&account, accountID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			abortWithLedgerError(ctx, errAccountNotFound)
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if account.Status == accountClosed {
+		abortWithLedgerError(ctx, checkActive(&account))
+		return
+	}
+
+	invitee := model.Auth{}
+	if err := m.db.Where("username = ?", payload.Username).First(&invitee).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var existing int64
+	if err := m.db.Model(&model.AccountMember{}).
+		Where("account_id = ? AND auth_id = ?", accountID, invitee.AuthID).
+		Count(&existing).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if existing > 0 {
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "User is already a member of this account",
+		})
+		return
+	}
+
+	invitation := model.AccountInvitation{
+		AccountID: accountID,
+		AuthID:    invitee.AuthID,
+		Role:      payload.Role,
+		InvitedBy: ctx.GetInt64("auth_id"),
+		Status:    invitationPending,
+		CreatedAt: time.Now(),
+	}
+	result := m.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&invitation)
+	if result.Error != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": result.Error.Error(),
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "User already has a pending invitation to this account",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    invitation,
+	})
+}
+
+// Revoke withdraws a pending invitation to the account.
+func (m *memberImplement) Revoke(ctx *gin.Context) {
+	accountID := ctx.GetInt64("account_id")
+
+	result := m.db.Model(&model.AccountInvitation{}).
+		Where("account_invitation_id = ? AND account_id = ? AND status = ?", ctx.Param("id"), accountID, invitationPending).
+		Updates(map[string]interface{}{
+			"status":       invitationRevoked,
+			"responded_at": time.Now(),
+		})
+	if result.Error != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": result.Error.Error(),
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "Not found",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Revoke success",
+	})
+}
+
+// Remove takes a member off the account. The last owner can't be removed.
+func (m *memberImplement) Remove(ctx *gin.Context) {
+	accountID := ctx.GetInt64("account_id")
+
+	tx := m.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// locking the account serializes membership changes, so two owners can't
+	// remove each other at the same time
+	if _, err := lockAccounts(tx, accountID); err != nil {
+		tx.Rollback()
+		abortWithLedgerError(ctx, err)
+		return
+	}
+
+	member := model.AccountMember{}
+	if err := tx.First(&member, "account_id = ? AND auth_id = ?", accountID, ctx.Param("auth_id")).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Not found",
+			})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if member.Role == model.RoleOwner {
+		var owners int64
+		if err := tx.Model(&model.AccountMember{}).
+			Where("account_id = ? AND role = ?", accountID, model.RoleOwner).
+			Count(&owners).Error; err != nil {
+			tx.Rollback()
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if owners <= 1 {
+			tx.Rollback()
+			ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "An account needs at least one owner",
+			})
+			return
+		}
+	}
+
+	if err := tx.Delete(&member).Error; err != nil {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Delete success",
+		"data":    member,
+	})
+}
+
+// Accounts lists the accounts the caller is a member of and their role on
+// each. Pass one of them in X-Account-ID to act on it.
+func (m *memberImplement) Accounts(ctx *gin.Context) {
+	var accounts []membershipView
+	authID := ctx.GetInt64("auth_id")
+
+	if err := m.db.Table("account_member").
+		Select("account.account_id, account.name, account.currency, account.status, account_member.role").
+		Joins("JOIN account ON account.account_id = account_member.account_id").
+		Where("account_member.auth_id = ?", authID).
+		Order("account.account_id").
+		Scan(&accounts).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": accounts,
+	})
+}
+
+// Invitations lists the caller's pending invitations.
+func (m *memberImplement) Invitations(ctx *gin.Context) {
+	var invitations []model.AccountInvitation
+	authID := ctx.GetInt64("auth_id")
+
+	if err := m.db.Where("auth_id = ? AND status = ?", authID, invitationPending).
+		Order("account_invitation_id DESC").
+		Find(&invitations).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": invitations,
+	})
+}
+
+// respond settles one of the caller's pending invitations. When accept is
+// true the caller becomes a member with the invited role.
+func (m *memberImplement) respond(ctx *gin.Context, accept bool) {
+	authID := ctx.GetInt64("auth_id")
+
+	tx := m.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	invitation := model.AccountInvitation{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&invitation, "account_invitation_id = ? AND auth_id = ? AND status = ?", ctx.Param("id"), authID, invitationPending).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Not found",
+			})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	now := time.Now()
+	invitation.Status = invitationDeclined
+	invitation.RespondedAt = &now
+
+	if accept {
+		invitation.Status = invitationAccepted
+
+		member := model.AccountMember{
+			AccountID: invitation.AccountID,
+			AuthID:    authID,
+			Role:      invitation.Role,
+			CreatedAt: now,
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "account_id"}, {Name: "auth_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"role"}),
+		}).Create(&member).Error; err != nil {
+			tx.Rollback()
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+
+	if err := tx.Model(&invitation).
+		Select("status", "responded_at").
+		Updates(&invitation).Error; err != nil {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Update success",
+		"data":    invitation,
+	})
+}
+
+func (m *memberImplement) Accept(ctx *gin.Context) {
+	m.respond(ctx, true)
+}
+
+func (m *memberImplement) Decline(ctx *gin.Context) {
+	m.respond(ctx, false)
+}
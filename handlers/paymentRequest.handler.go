@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"errors"
+	"example/model"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Statuses a payment request can be in. Only a pending request that has not
+// expired can be paid.
+const (
+	requestPending   = "pending"
+	requestPaid      = "paid"
+	requestDeclined  = "declined"
+	requestCancelled = "cancelled"
+	requestExpired   = "expired"
+)
+
+const requestDefaultExpiry = 7 * 24 * time.Hour
+
+var errRequestNotPending = errors.New("payment request is no longer pending")
+
+type PaymentRequestInterface interface {
+	Create(*gin.Context)
+	List(*gin.Context)
+	Accept(*gin.Context)
+	Decline(*gin.Context)
+	Cancel(*gin.Context)
+}
+
+type paymentRequestImplement struct {
+	db *gorm.DB
+}
+
+func NewPaymentRequest(db *gorm.DB) PaymentRequestInterface {
+	return &paymentRequestImplement{
+		db: db,
+	}
+}
+
+type paymentRequestPayload struct {
+	PayerID int64  `json:"payer_account_id" binding:"required"`
+	Amount  int64  `json:"amount" binding:"required,gt=0"`
+	Note    string `json:"note" binding:"max=140"`
+	// seconds until the request expires, defaults to seven days
+	ExpiresIn int64 `json:"expires_in" binding:"gte=0,lte=7776000"`
+}
+
+// lockPaymentRequest loads a payment request with SELECT ... FOR UPDATE,
+// writing the error response itself when it can't.
+func lockPaymentRequest(ctx *gin.Context, tx *gorm.DB) (*model.PaymentRequest, bool) {
+	request := model.PaymentRequest{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&request, "payment_request_id = ?", ctx.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Not found",
+			})
+			return nil, false
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return nil, false
+	}
+
+	return &request, true
+}
+
+// newPaymentRequest checks that payer can be asked for amount by the requester
+// account and saves a pending request. Both accounts must be active and hold
+// the same currency.
+func newPaymentRequest(tx *gorm.DB, requesterID, payerID, amount int64, note string, requestedBy int64, expiresAt time.Time) (*model.PaymentRequest, error) {
+	if amount <= 0 {
+		return nil, errInvalidAmount
+	}
+	if requesterID == payerID {
+		return nil, errSameAccount
+	}
+
+	var accounts []model.Account
+	if err := tx.Where("account_id IN ?", []int64{requesterID, payerID}).Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	if len(accounts) != 2 {
+		return nil, errAccountNotFound
+	}
+	if err := checkActive(&accounts[0], &accounts[1]); err != nil {
+		return nil, err
+	}
+	if accounts[0].Currency != accounts[1].Currency {
+		return nil, errCurrencyMismatch
+	}
+
+	request := model.PaymentRequest{
+		RequesterAccountID: requesterID,
+		PayerAccountID:     payerID,
+		Amount:             amount,
+		Currency:           accounts[0].Currency,
+		Note:               strings.TrimSpace(note),
+		Status:             requestPending,
+		RequestedBy:        requestedBy,
+		ExpiresAt:          expiresAt,
+		CreatedAt:          time.Now(),
+	}
+	if err := tx.Create(&request).Error; err != nil {
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+// Create asks another account for money. The payer sees the request in their
+// list and can accept or decline it until it expires.
+func (p *paymentRequestImplement) Create(ctx *gin.Context) {
+	payload := paymentRequestPayload{}
+	accountID := ctx.GetInt64("account_id")
+
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	expiresAt := time.Now().Add(expiresIn(payload.ExpiresIn, requestDefaultExpiry))
+	request, err := newPaymentRequest(p.db, accountID, payload.PayerID, payload.Amount, payload.Note, ctx.GetInt64("auth_id"), expiresAt)
+	if err != nil {
+		abortWithLedgerError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    request,
+	})
+}
+
+// List returns the requests the caller's account was asked to pay
+// (direction=in) or sent (direction=out), newest first. Without a direction
+// both are listed. status filters by status.
+func (p *paymentRequestImplement) List(ctx *gin.Context) {
+	var requests []model.PaymentRequest
+	accountID := ctx.GetInt64("account_id")
+
+	query := p.db.Model(&model.PaymentRequest{})
+	switch ctx.Query("direction") {
+	case "":
+		query = query.Where("payer_account_id = ? OR requester_account_id = ?", accountID, accountID)
+	case "in":
+		query = query.Where("payer_account_id = ?", accountID)
+	case "out":
+		query = query.Where("requester_account_id = ?", accountID)
+	default:
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "direction must be in or out",
+		})
+		return
+	}
+
+	if status := ctx.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Order("payment_request_id DESC").Find(&requests).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": requests,
+	})
+}
+
+// Accept pays a request addressed to the caller's account with a transfer to
+// the requester, fee included.
+func (p *paymentRequestImplement) Accept(ctx *gin.Context) {
+	accountID := ctx.GetInt64("account_id")
+
+	tx := p.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	request, ok := lockPaymentRequest(ctx, tx)
+	if !ok {
+		tx.Rollback()
+		return
+	}
+
+	if request.PayerAccountID != accountID {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Only the payer can accept a request",
+		})
+		return
+	}
+
+	if request.Status != requestPending || !request.ExpiresAt.After(time.Now()) {
+		tx.Rollback()
+		abortWithLedgerError(ctx, errRequestNotPending)
+		return
+	}
+
+	memo := fmt.Sprintf("Request %d", request.PaymentRequestID)
+	if request.Note != "" {
+		memo += ": " + request.Note
+	}
+
+	result, err := transferFunds(tx, categoryTransfer, request.PayerAccountID, request.RequesterAccountID, request.Amount, memo)
+	if err != nil {
+		tx.Rollback()
+		abortWithLedgerError(ctx, err)
+		return
+	}
+
+	now := time.Now()
+	request.Status = requestPaid
+	request.Reference = &result.Reference
+	request.RespondedAt = &now
+	if err := tx.Model(request).
+		Select("status", "reference", "responded_at").
+		Updates(request).Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":   "Update success",
+		"data":      request,
+		"reference": result.Reference,
+		"fee":       result.Fee,
+	})
+}
+
+// close ends a pending request without moving any money. Only the account on
+// the given side of the request may do it.
+func (p *paymentRequestImplement) close(ctx *gin.Context, status string) {
+	accountID := ctx.GetInt64("account_id")
+
+	tx := p.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	request, ok := lockPaymentRequest(ctx, tx)
+	if !ok {
+		tx.Rollback()
+		return
+	}
+
+	allowed := request.PayerAccountID == accountID
+	if status == requestCancelled {
+		allowed = request.RequesterAccountID == accountID
+	}
+	if !allowed {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Forbidden",
+		})
+		return
+	}
+
+	if request.Status != requestPending {
+		tx.Rollback()
+		abortWithLedgerError(ctx, errRequestNotPending)
+		return
+	}
+
+	// a request that ran out on its own is recorded as expired
+	now := time.Now()
+	if !request.ExpiresAt.After(now) {
+		status = requestExpired
+	}
+
+	request.Status = status
+	request.RespondedAt = &now
+	if err := tx.Model(request).
+		Select("status", "responded_at").
+		Updates(request).Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Update success",
+		"data":    request,
+	})
+}
+
+// Decline turns down a request addressed to the caller's account.
+func (p *paymentRequestImplement) Decline(ctx *gin.Context) {
+	p.close(ctx, requestDeclined)
+}
+
+// Cancel withdraws a request the caller's account sent.
+func (p *paymentRequestImplement) Cancel(ctx *gin.Context) {
+	p.close(ctx, requestCancelled)
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"example/model"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PaymentRequestWorker expires payment requests nobody answered in time.
+type PaymentRequestWorker struct {
+	db *gorm.DB
+}
+
+func NewPaymentRequestWorker(db *gorm.DB) *PaymentRequestWorker {
+	return &PaymentRequestWorker{
+		db: db,
+	}
+}
+
+// Start expires overdue requests every interval in a new goroutine. Accepting
+// a request checks its expiry itself, so the interval only bounds how long an
+// overdue request is still listed as pending.
+func (w *PaymentRequestWorker) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			expired, err := expirePaymentRequests(w.db, now)
+			if err != nil {
+				log.Printf("payment request worker: %v", err)
+				continue
+			}
+			if expired > 0 {
+				log.Printf("payment request worker: expired %d requests", expired)
+			}
+		}
+	}()
+}
+
+// expirePaymentRequests marks every pending request that expired by now.
+func expirePaymentRequests(db *gorm.DB, now time.Time) (int64, error) {
+	result := db.Model(&model.PaymentRequest{}).
+		Where("status = ? AND expires_at <= ?", requestPending, now).
+		Updates(map[string]interface{}{
+			"status":       requestExpired,
+			"responded_at": now,
+		})
+
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"errors"
+	"example/model"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errPocketNotFound = errors.New("pocket not found")
+
+type PocketInterface interface {
+	Create(*gin.Context)
+	List(*gin.Context)
+	Rename(*gin.Context)
+	Deposit(*gin.Context)
+	Withdraw(*gin.Context)
+}
+
+type pocketImplement struct {
+	db *gorm.DB
+}
+
+func NewPocket(db *gorm.DB) PocketInterface {
+	return &pocketImplement{
+		db: db,
+	}
+}
+
+type pocketPayload struct {
+	Name string `json:"name" binding:"required,max=60"`
+}
+
+type pocketMovePayload struct {
+	Amount int64 `json:"amount" binding:"required,gt=0"`
+}
+
+// accountPockets loads an account's pockets, oldest first.
+func accountPockets(db *gorm.DB, accountID int64) ([]model.Pocket, error) {
+	pockets := []model.Pocket{}
+	err := db.Where("account_id = ?", accountID).Order("pocket_id").Find(&pockets).Error
+	return pockets, err
+}
+
+// movePocket moves amount from the account's main balance into one of its
+// pockets, or out of it when amount is negative. The account balance stays
+// the same. It must run inside tx.
+func movePocket(tx *gorm.DB, accountID, pocketID, amount int64) (*model.Pocket, string, error) {
+	accounts, err := lockAccounts(tx, accountID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	account := accounts[accountID]
+	if err := checkActive(account); err != nil {
+		return nil, "", err
+	}
+
+	pocket := model.Pocket{}
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("pocket_id = ? AND account_id = ?", pocketID, accountID).
+		Limit(1).
+		Find(&pocket)
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, "", errPocketNotFound
+	}
+
+	// money going into a pocket must be available, money coming out must be
+	// in the pocket
+	if amount > 0 {
+		if err := checkAvailable(tx, account, amount); err != nil {
+			return nil, "", err
+		}
+	} else if pocket.Balance < -amount {
+		return nil, "", errInsufficientBalance
+	}
+
+	if err := tx.Model(&pocket).
+		UpdateColumn("balance", gorm.Expr("balance + ?", amount)).Error; err != nil {
+		return nil, "", err
+	}
+	pocket.Balance += amount
+
+	reference, err := recordPocketMove(tx, account, pocket.PocketID, amount)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &pocket, reference, nil
+}
+
+func (p *pocketImplement) Create(ctx *gin.Context) {
+	payload := pocketPayload{}
+	accountID := ctx.GetInt64("account_id")
+
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	pocket := model.Pocket{
+		AccountID: accountID,
+		Name:      strings.TrimSpace(payload.Name),
+		CreatedAt: time.Now(),
+	}
+	if err := p.db.Create(&pocket).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    pocket,
+	})
+}
+
+func (p *pocketImplement) List(ctx *gin.Context) {
+	pockets, err := accountPockets(p.db, ctx.GetInt64("account_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": pockets,
+	})
+}
+
+func (p *pocketImplement) Rename(ctx *gin.Context) {
+	payload := pocketPayload{}
+	accountID := ctx.GetInt64("account_id")
+
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	result := p.db.Model(&model.Pocket{}).
+		Where("pocket_id = ? AND account_id = ?", ctx.Param("id"), accountID).
+		Update("name", strings.TrimSpace(payload.Name))
+	if result.Error != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": result.Error.Error(),
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "Not found",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Update success",
+	})
+}
+
+// move binds the amount of a pocket move and runs it in its own transaction.
+// sign is 1 to move money into the pocket and -1 to move it out.
+func (p *pocketImplement) move(ctx *gin.Context, sign int64) {
+	payload := pocketMovePayload{}
+	accountID := ctx.GetInt64("account_id")
+
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	pocketID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid pocket id",
+		})
+		return
+	}
+
+	tx := p.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	pocket, reference, err := movePocket(tx, accountID, pocketID, sign*payload.Amount)
+	if err != nil {
+		tx.Rollback()
+		abortWithLedgerError(ctx, err)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":   "Update success",
+		"data":      pocket,
+		"reference": reference,
+	})
+}
+
+// Deposit moves money from the main balance into the pocket.
+func (p *pocketImplement) Deposit(ctx *gin.Context) {
+	p.move(ctx, 1)
+}
+
+// Withdraw moves money from the pocket back to the main balance.
+func (p *pocketImplement) Withdraw(ctx *gin.Context) {
+	p.move(ctx, -1)
+}
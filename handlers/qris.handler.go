@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"example/model"
+	"example/qris"
+	"example/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// qrisCategoryCode is the merchant category code put on the bank's QR
+// codes, 4829 for money transfers.
+const qrisCategoryCode = "4829"
+
+// QRISConfig identifies the bank in QR payloads. GUID names the bank in the
+// merchant account template, e.g. "ID.CO.EXAMPLE.WWW", and City is printed
+// as the merchant city of every code.
+type QRISConfig struct {
+	GUID string
+	City string
+}
+
+type QRISInterface interface {
+	Payload(*gin.Context)
+	Pay(*gin.Context)
+}
+
+type qrisImplement struct {
+	db     *gorm.DB
+	config QRISConfig
+}
+
+func NewQRIS(db *gorm.DB, config QRISConfig) QRISInterface {
+	return &qrisImplement{
+		db:     db,
+		config: config,
+	}
+}
+
+type qrisPayPayload struct {
+	Payload string `json:"payload" binding:"required"`
+	// needed for a static code, must match the code's amount otherwise
+	Amount int64  `json:"amount" binding:"gte=0"`
+	Memo   string `json:"memo" binding:"max=140"`
+}
+
+// qrisText keeps the printable ASCII characters of s, the only ones a QR
+// field may hold, and cuts the result to at most n of them.
+func qrisText(s string, n int) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < n; i++ {
+		if qris.IsPrintableASCII(s[i : i+1]) {
+			b = append(b, s[i])
+		}
+	}
+	return string(b)
+}
+
+// newCodeReference returns the reference that makes a dynamic code single
+// use, e.g. QR1A2B3C4D5E6F7A8B.
+func newCodeReference() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "QR" + strings.ToUpper(hex.EncodeToString(b)), nil
+}
+
+// Payload returns a QR string other users can scan to pay the caller's
+// account. Without amount the code is static and the payer picks the amount,
+// with it the code is dynamic. note is shown to the payer as the purpose.
+func (q *qrisImplement) Payload(ctx *gin.Context) {
+	var account model.Account
+	accountID := ctx.GetInt64("account_id")
+
+	if err := q.db.First(&account, accountID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			abortWithLedgerError(ctx, errAccountNotFound)
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err := checkActive(&account); err != nil {
+		abortWithLedgerError(ctx, err)
+		return
+	}
+
+	currency, ok := utils.CurrencyNumeric(account.Currency)
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "currency has no numeric code",
+		})
+		return
+	}
+
+	name := qrisText(account.Name, 25)
+	if name == "" {
+		name = qrisText("Account "+strconv.FormatInt(account.AccountID, 10), 25)
+	}
+
+	payload := qris.Payload{
+		Accounts: []qris.MerchantAccount{{
+			Tag:    "26",
+			GUID:   q.config.GUID,
+			Fields: []qris.Field{{Tag: "01", Value: strconv.FormatInt(account.AccountID, 10)}},
+		}},
+		CategoryCode: qrisCategoryCode,
+		Currency:     currency,
+		CountryCode:  "ID",
+		MerchantName: name,
+		MerchantCity: qrisText(q.config.City, 15),
+	}
+
+	var amount int64
+	if value := ctx.Query("amount"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed <= 0 {
+			abortWithLedgerError(ctx, errInvalidAmount)
+			return
+		}
+		amount = parsed
+		payload.Dynamic = true
+		payload.Amount = utils.FormatAmount(amount, account.Currency)
+
+		reference, err := newCodeReference()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		payload.Additional = append(payload.Additional, qris.Field{Tag: qris.AdditionalReference, Value: reference})
+	}
+
+	if note := qrisText(ctx.Query("note"), 25); note != "" {
+		payload.Additional = append(payload.Additional, qris.Field{Tag: qris.AdditionalPurpose, Value: note})
+	}
+
+	encoded, err := payload.Encode()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"payload": encoded,
+		"amount":  amount,
+		"dynamic": payload.Dynamic,
+	})
+}
+
+// Pay reads a QR string issued by this bank and transfers its amount, or
+// the amount given for a static code, from the caller's account to the
+// account in the code. A dynamic code can only be paid once.
+func (q *qrisImplement) Pay(ctx *gin.Context) {
+	payload := qrisPayPayload{}
+	accountID := ctx.GetInt64("account_id")
+
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	code, err := qris.Decode(payload.Payload)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "invalid QR payload: " + err.Error(),
+		})
+		return
+	}
+
+	merchant, ok := code.Account(q.config.GUID)
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "QR code was not issued by this bank",
+		})
+		return
+	}
+	targetID, err := strconv.ParseInt(merchant.Get("01"), 10, 64)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "invalid QR payload: no account id",
+		})
+		return
+	}
+
+	currency, ok := utils.CurrencyFromNumeric(code.Currency)
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "QR code currency is not supported",
+		})
+		return
+	}
+
+	amount := payload.Amount
+	if code.Amount != "" {
+		amount, err = utils.ParseAmount(code.Amount, currency)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid QR payload: " + err.Error(),
+			})
+			return
+		}
+		if payload.Amount != 0 && payload.Amount != amount {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "amount does not match the QR code",
+			})
+			return
+		}
+	}
+
+	codeReference := code.AdditionalData(qris.AdditionalReference)
+	if code.Dynamic && codeReference == "" {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "invalid QR payload: dynamic code has no reference",
+		})
+		return
+	}
+
+	memo := payload.Memo
+	if memo == "" {
+		memo = code.AdditionalData(qris.AdditionalPurpose)
+	}
+	if memo == "" {
+		memo = "QR " + code.MerchantName
+	}
+
+	tx := q.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// the amount is in the code's currency, so both accounts must hold it
+	// before anything moves. The house account is locked with them to keep
+	// the lock order of the transfer's fee posting.
+	ids := []int64{accountID, targetID}
+	if houseAccountID != 0 {
+		ids = append(ids, houseAccountID)
+	}
+	accounts, err := lockAccounts(tx, ids...)
+	if err != nil {
+		tx.Rollback()
+		abortWithLedgerError(ctx, err)
+		return
+	}
+	if accounts[accountID].Currency != currency || accounts[targetID].Currency != currency {
+		tx.Rollback()
+		abortWithLedgerError(ctx, errCurrencyMismatch)
+		return
+	}
+
+	result, err := transferFunds(tx, categoryTransfer, accountID, targetID, amount, memo)
+	if err != nil {
+		tx.Rollback()
+		abortWithLedgerError(ctx, err)
+		return
+	}
+
+	// the unique (account_id, code_reference) constraint lets only one
+	// payment of a dynamic code through, even when two arrive at once
+	if code.Dynamic {
+		record := model.QRISPayment{
+			AccountID:      targetID,
+			CodeReference:  codeReference,
+			PayerAccountID: accountID,
+			Reference:      result.Reference,
+			PaidAt:         time.Now(),
+		}
+		created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if created.Error != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": created.Error.Error(),
+			})
+			return
+		}
+		if created.RowsAffected == 0 {
+			tx.Rollback()
+			ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "QR code was already paid",
+			})
+			return
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":        "Update success",
+		"amount":         amount,
+		"merchant_name":  code.MerchantName,
+		"sender_balance": result.Sender.Balance,
+		"reference":      result.Reference,
+		"fee":            result.Fee,
+	})
+}
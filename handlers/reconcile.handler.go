@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"example/model"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ReconcileInterface interface {
+	Report(*gin.Context)
+	Fix(*gin.Context)
+}
+
+type reconcileImplement struct {
+	db *gorm.DB
+}
+
+func NewReconcile(db *gorm.DB) ReconcileInterface {
+	return &reconcileImplement{
+		db: db,
+	}
+}
+
+// ReconcileMismatch is an account whose stored balance differs from the sum
+// of its transaction entries. Delta is balance minus ledger balance.
+type ReconcileMismatch struct {
+	AccountID     int64  `json:"account_id"`
+	Balance       int64  `json:"balance"`
+	LedgerBalance int64  `json:"ledger_balance"`
+	Delta         int64  `json:"delta"`
+	Reference     string `json:"reference,omitempty"`
+}
+
+type ReconcileReport struct {
+	CheckedAt       time.Time           `json:"checked_at"`
+	AccountsChecked int64               `json:"accounts_checked"`
+	Mismatches      []ReconcileMismatch `json:"mismatches"`
+	Adjusted        bool                `json:"adjusted"`
+}
+
+// Reconcile recomputes every account's balance from the transaction table
+// and reports the accounts that drifted. With fix set, each drift is closed
+// by an adjustment entry so the ledger matches the stored balance again.
+func Reconcile(db *gorm.DB, fix bool) (*ReconcileReport, error) {
+	report := ReconcileReport{
+		CheckedAt:  time.Now(),
+		Mismatches: []ReconcileMismatch{},
+		Adjusted:   fix,
+	}
+
+	if err := db.Model(&model.Account{}).Count(&report.AccountsChecked).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Table("account AS a").
+		Select("a.account_id, a.balance, COALESCE(SUM(t.amount), 0) AS ledger_balance, a.balance - COALESCE(SUM(t.amount), 0) AS delta").
+		Joins("LEFT JOIN transaction AS t ON t.account_id = a.account_id").
+		Group("a.account_id, a.balance").
+		Having("a.balance <> COALESCE(SUM(t.amount), 0)").
+		Order("a.account_id").
+		Scan(&report.Mismatches).Error; err != nil {
+		return nil, err
+	}
+
+	if !fix {
+		return &report, nil
+	}
+
+	for i := range report.Mismatches {
+		if err := adjustAccount(db, &report.Mismatches[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &report, nil
+}
+
+// adjustAccount writes the adjustment entry for one mismatch. The delta is
+// computed again under the account lock, since a transfer may have run
+// since the report query.
+func adjustAccount(db *gorm.DB, mismatch *ReconcileMismatch) error {
+	tx := db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	accounts, err := lockAccounts(tx, mismatch.AccountID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	account := accounts[mismatch.AccountID]
+
+	var ledger int64
+	if err := tx.Model(&model.Transaction{}).
+		Where("account_id = ?", account.AccountID).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&ledger).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	mismatch.Balance = account.Balance
+	mismatch.LedgerBalance = ledger
+	mismatch.Delta = account.Balance - ledger
+	if mismatch.Delta == 0 {
+		tx.Rollback()
+		return nil
+	}
+
+	reference, err := recordAdjustment(tx, account, mismatch.Delta)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	mismatch.Reference = reference
+
+	return tx.Commit().Error
+}
+
+// Report runs the reconciliation without changing anything.
+func (r *reconcileImplement) Report(ctx *gin.Context) {
+	r.reconcile(ctx, false)
+}
+
+// Fix runs the reconciliation and writes adjustment entries.
+func (r *reconcileImplement) Fix(ctx *gin.Context) {
+	r.reconcile(ctx, true)
+}
+
+func (r *reconcileImplement) reconcile(ctx *gin.Context, fix bool) {
+	report, err := Reconcile(r.db, fix)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    report,
+	})
+}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"example/model"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// rulePreviewLimit caps how many changed rows a preview lists. The count is
+// always complete.
+const rulePreviewLimit = 100
+
+type RuleInterface interface {
+	Create(*gin.Context)
+	List(*gin.Context)
+	Delete(*gin.Context)
+	Preview(*gin.Context)
+	Apply(*gin.Context)
+}
+
+type ruleImplement struct {
+	db *gorm.DB
+}
+
+func NewRule(db *gorm.DB) RuleInterface {
+	return &ruleImplement{
+		db: db,
+	}
+}
+
+type rulePayload struct {
+	CategoryID            int64   `json:"transaction_category_id" binding:"required"`
+	CounterpartyAccountID *int64  `json:"counterparty_account_id"`
+	MinAmount             *int64  `json:"min_amount" binding:"omitempty,gte=0"`
+	MaxAmount             *int64  `json:"max_amount" binding:"omitempty,gte=0"`
+	MemoContains          *string `json:"memo_contains"`
+	DayOfWeek             *int    `json:"day_of_week" binding:"omitempty,min=0,max=6"`
+	Priority              int     `json:"priority"`
+}
+
+// counterparty returns the other side of an entry: the recipient of a debit
+// or the sender of a credit.
+func counterparty(entry *model.Transaction) *int64 {
+	if entry.Amount < 0 {
+		return entry.ToAccountID
+	}
+	return entry.FromAccountID
+}
+
+func ruleMatches(rule *model.CategoryRule, entry *model.Transaction) bool {
+	if rule.CounterpartyAccountID != nil {
+		other := counterparty(entry)
+		if other == nil || *other != *rule.CounterpartyAccountID {
+			return false
+		}
+	}
+
+	amount := entry.Amount
+	if amount < 0 {
+		amount = -amount
+	}
+	if rule.MinAmount != nil && amount < *rule.MinAmount {
+		return false
+	}
+	if rule.MaxAmount != nil && amount > *rule.MaxAmount {
+		return false
+	}
+
+	if rule.MemoContains != nil && !strings.Contains(strings.ToLower(entry.Memo), strings.ToLower(*rule.MemoContains)) {
+		return false
+	}
+
+	if rule.DayOfWeek != nil && int(entry.TransactionDate.Weekday()) != *rule.DayOfWeek {
+		return false
+	}
+
+	return true
+}
+
+// matchRule returns the first rule matching the entry. Rules must already be
+// in evaluation order. Moves between an account's own pockets match no rule.
+func matchRule(rules []model.CategoryRule, entry *model.Transaction) *model.CategoryRule {
+	if entry.FromAccountID != nil && entry.ToAccountID != nil && *entry.FromAccountID == *entry.ToAccountID {
+		return nil
+	}
+
+	for i := range rules {
+		if ruleMatches(&rules[i], entry) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// accountRules loads an account's rules in evaluation order: lowest priority
+// number first, then oldest first.
+func accountRules(db *gorm.DB, accountID int64) ([]model.CategoryRule, error) {
+	var rules []model.CategoryRule
+	err := db.Where("account_id = ?", accountID).Order("priority, category_rule_id").Find(&rules).Error
+	return rules, err
+}
+
+// applyRules categorizes entries that are about to be recorded with the
+// rules of the account each entry belongs to. Entries no rule matches keep
+// their category.
+func applyRules(tx *gorm.DB, entries []model.Transaction) error {
+	rulesByAccount := map[int64][]model.CategoryRule{}
+
+	for i := range entries {
+		rules, ok := rulesByAccount[entries[i].AccountID]
+		if !ok {
+			var err error
+			if rules, err = accountRules(tx, entries[i].AccountID); err != nil {
+				return err
+			}
+			rulesByAccount[entries[i].AccountID] = rules
+		}
+
+		if rule := matchRule(rules, &entries[i]); rule != nil {
+			entries[i].TransactionCategoryID = rule.TransactionCategoryID
+		}
+	}
+
+	return nil
+}
+
+// bindRule reads and validates a rule for the caller's account.
+func (r *ruleImplement) bindRule(ctx *gin.Context) (*model.CategoryRule, bool) {
+	payload := rulePayload{}
+	accountID := ctx.GetInt64("account_id")
+
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return nil, false
+	}
+
+	if payload.CounterpartyAccountID == nil && payload.MinAmount == nil && payload.MaxAmount == nil &&
+		payload.MemoContains == nil && payload.DayOfWeek == nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "A rule needs at least one condition",
+		})
+		return nil, false
+	}
+
+	category, err := usableCategory(r.db, accountID, payload.CategoryID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Category not found",
+			})
+			return nil, false
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return nil, false
+	}
+	if !canFile(category, categoryTransfer) {
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Rules can't file transfers under another ledger category",
+		})
+		return nil, false
+	}
+
+	return &model.CategoryRule{
+		AccountID:             accountID,
+		TransactionCategoryID: payload.CategoryID,
+		CounterpartyAccountID: payload.CounterpartyAccountID,
+		MinAmount:             payload.MinAmount,
+		MaxAmount:             payload.MaxAmount,
+		MemoContains:          payload.MemoContains,
+		DayOfWeek:             payload.DayOfWeek,
+		Priority:              payload.Priority,
+		CreatedAt:             time.Now(),
+	}, true
+}
+
+func (r *ruleImplement) Create(ctx *gin.Context) {
+	rule, ok := r.bindRule(ctx)
+	if !ok {
+		return
+	}
+
+	if err := r.db.Create(rule).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    rule,
+	})
+}
+
+func (r *ruleImplement) List(ctx *gin.Context) {
+	rules, err := accountRules(r.db, ctx.GetInt64("account_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": rules,
+	})
+}
+
+func (r *ruleImplement) Delete(ctx *gin.Context) {
+	id := ctx.Param("id")
+	accountID := ctx.GetInt64("account_id")
+
+	result := r.db.Where("category_rule_id = ? AND account_id = ?", id, accountID).Delete(&model.CategoryRule{})
+	if result.Error != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": result.Error.Error(),
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "Not found",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Delete success",
+		"data": map[string]string{
+			"category_rule_id": id,
+		},
+	})
+}
+
+// eachEntry calls fn for every entry of the account that rules may
+// categorize, loading them in batches so long histories are not held in
+// memory at once. Only transfers are categorized; fees, adjustments and the
+// other ledger kinds are skipped.
+func eachEntry(db *gorm.DB, accountID int64, fn func(entry *model.Transaction) error) error {
+	var entries []model.Transaction
+	return db.Where("account_id = ? AND kind = ?", accountID, categoryTransfer).
+		FindInBatches(&entries, 500, func(batch *gorm.DB, _ int) error {
+			for i := range entries {
+				if err := fn(&entries[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// Preview lists the caller's entries that a new rule would recategorize,
+// taking the priority of the existing rules into account. Nothing is saved.
+func (r *ruleImplement) Preview(ctx *gin.Context) {
+	candidate, ok := r.bindRule(ctx)
+	if !ok {
+		return
+	}
+
+	rules, err := accountRules(r.db, candidate.AccountID)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// an unsaved rule has id 0 and sorts after existing rules of the same
+	// priority, just like it would once created
+	rules = append(rules, *candidate)
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority < rules[j].Priority })
+
+	count := 0
+	changes := []model.Transaction{}
+	err = eachEntry(r.db, candidate.AccountID, func(entry *model.Transaction) error {
+		rule := matchRule(rules, entry)
+		if rule == nil || rule.CategoryRuleID != 0 || entry.TransactionCategoryID == rule.TransactionCategoryID {
+			return nil
+		}
+
+		count++
+		if len(changes) < rulePreviewLimit {
+			changes = append(changes, *entry)
+		}
+		return nil
+	})
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"count":   count,
+		"data":    changes,
+	})
+}
+
+// Apply re-runs the caller's rules over their whole history.
+func (r *ruleImplement) Apply(ctx *gin.Context) {
+	accountID := ctx.GetInt64("account_id")
+
+	rules, err := accountRules(r.db, accountID)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	updated := 0
+	err = eachEntry(r.db, accountID, func(entry *model.Transaction) error {
+		rule := matchRule(rules, entry)
+		if rule == nil || entry.TransactionCategoryID == rule.TransactionCategoryID {
+			return nil
+		}
+
+		updated++
+		return r.db.Model(&model.Transaction{}).
+			Where("transaction_id = ?", entry.TransactionID).
+			Update("transaction_category_id", rule.TransactionCategoryID).Error
+	})
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Update success",
+		"updated": updated,
+	})
+}
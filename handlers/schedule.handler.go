@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"example/model"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Statuses a schedule can be in. Only active schedules are picked up by the
+// worker; finished and cancelled are final.
+const (
+	scheduleActive    = "active"
+	schedulePaused    = "paused"
+	scheduleFinished  = "finished"
+	scheduleCancelled = "cancelled"
+)
+
+type ScheduleInterface interface {
+	Create(*gin.Context)
+	List(*gin.Context)
+	Read(*gin.Context)
+	Update(*gin.Context)
+	Delete(*gin.Context)
+}
+
+type scheduleImplement struct {
+	db *gorm.DB
+}
+
+func NewSchedule(db *gorm.DB) ScheduleInterface {
+	return &scheduleImplement{
+		db: db,
+	}
+}
+
+type schedulePayload struct {
+	TargetID      int64      `json:"target_account_id" binding:"required"`
+	Amount        int64      `json:"amount" binding:"required,gt=0"`
+	IntervalUnit  string     `json:"interval_unit" binding:"required,oneof=day week month"`
+	IntervalCount int        `json:"interval_count" binding:"gte=0"`
+	StartAt       time.Time  `json:"start_at" binding:"required"`
+	EndDate       *time.Time `json:"end_date"`
+}
+
+type scheduleUpdatePayload struct {
+	Amount  *int64     `json:"amount" binding:"omitempty,gt=0"`
+	EndDate *time.Time `json:"end_date"`
+	Status  *string    `json:"status" binding:"omitempty,oneof=active paused"`
+}
+
+// findSchedule loads a schedule owned by the caller, writing the error
+// response itself when it can't.
+func (s *scheduleImplement) findSchedule(ctx *gin.Context) (*model.Schedule, bool) {
+	schedule := model.Schedule{}
+	accountID := ctx.GetInt64("account_id")
+
+	if err := s.db.First(&schedule, "schedule_id = ? AND account_id = ?", ctx.Param("id"), accountID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Not found",
+			})
+			return nil, false
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return nil, false
+	}
+
+	return &schedule, true
+}
+
+func (s *scheduleImplement) Create(ctx *gin.Context) {
+	payload := schedulePayload{}
+	accountID := ctx.GetInt64("account_id")
+
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if payload.TargetID == accountID {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": errSameAccount.Error(),
+		})
+		return
+	}
+
+	if payload.EndDate != nil && payload.EndDate.Before(payload.StartAt) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "end_date must be after start_at",
+		})
+		return
+	}
+
+	if payload.IntervalCount == 0 {
+		payload.IntervalCount = 1
+	}
+
+	target := model.Account{}
+	if err := s.db.First(&target, payload.TargetID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Target account not found",
+			})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	schedule := model.Schedule{
+		AccountID:       accountID,
+		TargetAccountID: payload.TargetID,
+		Amount:          payload.Amount,
+		IntervalUnit:    payload.IntervalUnit,
+		IntervalCount:   payload.IntervalCount,
+		StartAt:         payload.StartAt,
+		NextRunAt:       payload.StartAt,
+		EndDate:         payload.EndDate,
+		Status:          scheduleActive,
+		CreatedAt:       time.Now(),
+	}
+
+	if err := s.db.Create(&schedule).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    schedule,
+	})
+}
+
+func (s *scheduleImplement) List(ctx *gin.Context) {
+	var schedules []model.Schedule
+	accountID := ctx.GetInt64("account_id")
+
+	if err := s.db.Where("account_id = ?", accountID).Order("schedule_id").Find(&schedules).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": schedules,
+	})
+}
+
+func (s *scheduleImplement) Read(ctx *gin.Context) {
+	schedule, ok := s.findSchedule(ctx)
+	if !ok {
+		return
+	}
+
+	var runs []model.ScheduleRun
+	if err := s.db.Where("schedule_id = ?", schedule.ScheduleID).Order("schedule_run_id DESC").Find(&runs).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": schedule,
+		"runs": runs,
+	})
+}
+
+func (s *scheduleImplement) Update(ctx *gin.Context) {
+	payload := scheduleUpdatePayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	schedule, ok := s.findSchedule(ctx)
+	if !ok {
+		return
+	}
+
+	if schedule.Status == scheduleFinished || schedule.Status == scheduleCancelled {
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Schedule is " + schedule.Status,
+		})
+		return
+	}
+
+	// the due run would otherwise still go out before the worker noticed
+	if payload.EndDate != nil && payload.EndDate.Before(schedule.NextRunAt) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "end_date must not be before next_run_at",
+		})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if payload.Amount != nil {
+		updates["amount"] = *payload.Amount
+	}
+	if payload.EndDate != nil {
+		updates["end_date"] = *payload.EndDate
+	}
+	if payload.Status != nil {
+		updates["status"] = *payload.Status
+	}
+
+	if err := s.db.Model(schedule).Updates(updates).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Update success",
+		"data":    schedule,
+	})
+}
+
+// Delete cancels the schedule. It is kept so its run history stays readable.
+func (s *scheduleImplement) Delete(ctx *gin.Context) {
+	schedule, ok := s.findSchedule(ctx)
+	if !ok {
+		return
+	}
+
+	if err := s.db.Model(schedule).Update("status", scheduleCancelled).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Delete success",
+		"data": map[string]int64{
+			"schedule_id": schedule.ScheduleID,
+		},
+	})
+}
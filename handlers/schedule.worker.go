@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"example/model"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Outcomes recorded on a schedule run.
+const (
+	runSuccess  = "success"
+	runRetrying = "retrying"
+	runFailed   = "failed"
+)
+
+// ScheduleRetryPolicy controls how a run that failed because the sender's
+// balance was too low is retried. Any other failure is not retried.
+type ScheduleRetryPolicy struct {
+	MaxRetries int
+	Delay      time.Duration
+}
+
+// ScheduleWorker executes due schedules in the background.
+type ScheduleWorker struct {
+	db     *gorm.DB
+	policy ScheduleRetryPolicy
+}
+
+func NewScheduleWorker(db *gorm.DB, policy ScheduleRetryPolicy) *ScheduleWorker {
+	return &ScheduleWorker{
+		db:     db,
+		policy: policy,
+	}
+}
+
+// Start checks for due schedules every interval in a new goroutine.
+func (w *ScheduleWorker) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			w.RunDue(now)
+		}
+	}()
+}
+
+// RunDue executes every active schedule that is due at now, each in its own
+// database transaction.
+func (w *ScheduleWorker) RunDue(now time.Time) {
+	var ids []int64
+	if err := w.db.Model(&model.Schedule{}).
+		Where("status = ? AND COALESCE(retry_at, next_run_at) <= ?", scheduleActive, now).
+		Order("next_run_at").
+		Pluck("schedule_id", &ids).Error; err != nil {
+		log.Printf("schedule worker: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		if err := w.runSchedule(id, now); err != nil {
+			log.Printf("schedule worker: schedule %d: %v", id, err)
+		}
+	}
+}
+
+// occurrence returns the k-th run time of the schedule, counting StartAt as
+// the 0th. Monthly runs keep the day of StartAt and fall on the last day of
+// shorter months, so a schedule on the 31st doesn't drift.
+func occurrence(schedule *model.Schedule, k int) time.Time {
+	start := schedule.StartAt
+	switch schedule.IntervalUnit {
+	case "week":
+		return start.AddDate(0, 0, 7*k*schedule.IntervalCount)
+	case "month":
+		first := time.Date(start.Year(), start.Month()+time.Month(k*schedule.IntervalCount), 1,
+			start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+		lastDay := first.AddDate(0, 1, -1).Day()
+		return first.AddDate(0, 0, min(start.Day(), lastDay)-1)
+	default:
+		return start.AddDate(0, 0, k*schedule.IntervalCount)
+	}
+}
+
+// nextOccurrence returns the first run time of the schedule after from.
+func nextOccurrence(schedule *model.Schedule, from time.Time) time.Time {
+	if from.Before(schedule.StartAt) {
+		return schedule.StartAt
+	}
+
+	// estimate how many intervals have passed, then step to the exact one
+	var k int
+	switch schedule.IntervalUnit {
+	case "month":
+		months := (from.Year()-schedule.StartAt.Year())*12 + int(from.Month()-schedule.StartAt.Month())
+		k = months / schedule.IntervalCount
+	case "week":
+		k = int(from.Sub(schedule.StartAt).Hours() / (24 * 7 * float64(schedule.IntervalCount)))
+	default:
+		k = int(from.Sub(schedule.StartAt).Hours() / (24 * float64(schedule.IntervalCount)))
+	}
+
+	for k > 0 && occurrence(schedule, k).After(from) {
+		k--
+	}
+	for !occurrence(schedule, k).After(from) {
+		k++
+	}
+	return occurrence(schedule, k)
+}
+
+// advance moves the schedule to its first occurrence after now, skipping
+// any it missed while it wasn't running, or finishes it when that falls after
+// the end date.
+func advance(schedule *model.Schedule, now time.Time) {
+	from := schedule.NextRunAt
+	if now.After(from) {
+		from = now
+	}
+
+	schedule.NextRunAt = nextOccurrence(schedule, from)
+	schedule.Attempt = 0
+	schedule.RetryAt = nil
+
+	if schedule.EndDate != nil && schedule.NextRunAt.After(*schedule.EndDate) {
+		schedule.Status = scheduleFinished
+	}
+}
+
+func (w *ScheduleWorker) runSchedule(id int64, now time.Time) error {
+	tx := w.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// SKIP LOCKED lets several instances share the work without running the
+	// same schedule twice
+	schedule := model.Schedule{}
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("schedule_id = ? AND status = ? AND COALESCE(retry_at, next_run_at) <= ?", id, scheduleActive, now).
+		Limit(1).
+		Find(&schedule)
+	if result.Error != nil {
+		tx.Rollback()
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return nil
+	}
+
+	// a schedule whose end date passed while it was waiting finishes without
+	// another transfer
+	if schedule.EndDate != nil && schedule.NextRunAt.After(*schedule.EndDate) {
+		if err := tx.Model(&schedule).Update("status", scheduleFinished).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit().Error
+	}
+
+	run := model.ScheduleRun{
+		ScheduleID: schedule.ScheduleID,
+		DueAt:      schedule.NextRunAt,
+		RunAt:      now,
+		Attempt:    schedule.Attempt + 1,
+	}
+
+	if err := tx.SavePoint("transfer").Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// same code path as accountImplement.Transfer
+	transfer, err := transferFunds(tx, categoryTransfer, schedule.AccountID, schedule.TargetAccountID, schedule.Amount, fmt.Sprintf("Schedule %d", schedule.ScheduleID))
+	switch {
+	case err == nil:
+		run.Status = runSuccess
+		run.Reference = &transfer.Reference
+		advance(&schedule, now)
+	case errors.Is(err, errInsufficientBalance) && run.Attempt <= w.policy.MaxRetries:
+		if err := tx.RollbackTo("transfer").Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		run.Status = runRetrying
+		run.Error = err.Error()
+		retryAt := now.Add(w.policy.Delay)
+		schedule.Attempt = run.Attempt
+		schedule.RetryAt = &retryAt
+	default:
+		if err := tx.RollbackTo("transfer").Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		run.Status = runFailed
+		run.Error = err.Error()
+		advance(&schedule, now)
+	}
+
+	if err := tx.Create(&run).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Model(&schedule).
+		Select("next_run_at", "attempt", "retry_at", "status").
+		Updates(&schedule).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
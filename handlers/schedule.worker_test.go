@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"example/model"
+	"testing"
+	"time"
+)
+
+func TestNextOccurrence(t *testing.T) {
+	at := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	every := func(unit string, count int, start time.Time) *model.Schedule {
+		return &model.Schedule{IntervalUnit: unit, IntervalCount: count, StartAt: start}
+	}
+	onThe31st := every("month", 1, at(2025, 1, 31, 10))
+
+	steps := []struct {
+		name     string
+		schedule *model.Schedule
+		from     time.Time
+		want     time.Time
+	}{
+		{"first run is the start", onThe31st, at(2025, 1, 1, 0), at(2025, 1, 31, 10)},
+		{"short month clamps to its last day", onThe31st, at(2025, 1, 31, 10), at(2025, 2, 28, 10)},
+		{"clamping does not drift", onThe31st, at(2025, 2, 28, 10), at(2025, 3, 31, 10)},
+		{"thirty day month", onThe31st, at(2025, 3, 31, 10), at(2025, 4, 30, 10)},
+		{"missed months are skipped", onThe31st, at(2025, 8, 15, 0), at(2025, 8, 31, 10)},
+		{"year boundary", onThe31st, at(2025, 12, 31, 10), at(2026, 1, 31, 10)},
+		{"leap February", every("month", 1, at(2024, 1, 30, 10)), at(2024, 1, 30, 10), at(2024, 2, 29, 10)},
+		{"quarterly keeps the 31st", every("month", 3, at(2025, 1, 31, 10)), at(2025, 4, 30, 10), at(2025, 7, 31, 10)},
+		{"weekly later the same day", every("week", 1, at(2025, 1, 6, 10)), at(2025, 1, 20, 9), at(2025, 1, 20, 10)},
+		{"fortnightly", every("week", 2, at(2025, 1, 6, 10)), at(2025, 1, 6, 10), at(2025, 1, 20, 10)},
+		{"every other day", every("day", 2, at(2025, 1, 1, 10)), at(2025, 1, 4, 12), at(2025, 1, 5, 10)},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			if got := nextOccurrence(step.schedule, step.from); !got.Equal(step.want) {
+				t.Errorf("nextOccurrence(%s) = %s, want %s", step.from, got, step.want)
+			}
+		})
+	}
+}
+
+// TestRunScheduleAfterEndDate runs a schedule that became due after its end
+// date. It must finish without moving any money.
+func TestRunScheduleAfterEndDate(t *testing.T) {
+	db := testDB(t)
+
+	defer SetHouseAccount(houseAccountID)
+	SetHouseAccount(0)
+
+	sender := openTestAccount(t, db, "IDR", 100000)
+	recipient := openTestAccount(t, db, "IDR", 0)
+
+	now := time.Now()
+	endDate := now.Add(-2 * time.Hour)
+	schedule := model.Schedule{
+		AccountID:       sender,
+		TargetAccountID: recipient,
+		Amount:          5000,
+		IntervalUnit:    "day",
+		IntervalCount:   1,
+		StartAt:         now.AddDate(0, 0, -3),
+		NextRunAt:       now.Add(-time.Hour),
+		EndDate:         &endDate,
+		Status:          scheduleActive,
+		CreatedAt:       now.AddDate(0, 0, -3),
+	}
+	if err := db.Create(&schedule).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	worker := NewScheduleWorker(db, ScheduleRetryPolicy{})
+	if err := worker.runSchedule(schedule.ScheduleID, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.First(&schedule, schedule.ScheduleID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if schedule.Status != scheduleFinished {
+		t.Errorf("schedule is %s, want %s", schedule.Status, scheduleFinished)
+	}
+
+	var runs int64
+	if err := db.Model(&model.ScheduleRun{}).Where("schedule_id = ?", schedule.ScheduleID).Count(&runs).Error; err != nil {
+		t.Fatal(err)
+	}
+	recipientAccount := model.Account{}
+	if err := db.First(&recipientAccount, recipient).Error; err != nil {
+		t.Fatal(err)
+	}
+	if runs != 0 || recipientAccount.Balance != 0 {
+		t.Errorf("schedule past its end date ran %d times and paid %d", runs, recipientAccount.Balance)
+	}
+}
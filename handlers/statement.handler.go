@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"example/model"
+	"example/utils"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// statementFlushEvery is how many entries are written between flushes, so
+// large statements reach the client while they are being produced.
+const statementFlushEvery = 100
+
+// statementWriter renders a statement in one export format. Opening is
+// called once, then Entry for every transaction in order, then Closing.
+// Flush pushes anything the writer buffers to the underlying writer.
+type statementWriter interface {
+	Opening(balance int64) error
+	Entry(entry *model.Transaction, category string, balance int64) error
+	Flush() error
+	Closing(balance int64) error
+}
+
+func newStatementWriter(format string, w io.Writer, account *model.Account, from, to time.Time) (statementWriter, string, bool) {
+	switch format {
+	case "csv":
+		return &csvStatement{w: csv.NewWriter(w), from: from, to: to}, "text/csv", true
+	case "jsonl":
+		return &jsonlStatement{enc: json.NewEncoder(w), from: from, to: to}, "application/x-ndjson", true
+	case "ofx":
+		return &ofxStatement{w: w, account: account, from: from, to: to}, "application/x-ofx", true
+	}
+	return nil, "", false
+}
+
+// csvStatement writes one record per line with a leading record type of
+// opening, entry or closing.
+type csvStatement struct {
+	w        *csv.Writer
+	from, to time.Time
+}
+
+func (s *csvStatement) Opening(balance int64) error {
+	s.w.Write([]string{"type", "transaction_id", "date", "reference", "category", "from_account_id", "to_account_id", "amount", "currency", "balance"})
+	s.w.Write([]string{"opening", "", s.from.Format(time.RFC3339), "", "", "", "", "", "", strconv.FormatInt(balance, 10)})
+	return s.w.Error()
+}
+
+func (s *csvStatement) Entry(entry *model.Transaction, category string, balance int64) error {
+	s.w.Write([]string{
+		"entry",
+		strconv.FormatInt(entry.TransactionID, 10),
+		entry.TransactionDate.Format(time.RFC3339),
+		entry.Reference,
+		category,
+		optionalID(entry.FromAccountID),
+		optionalID(entry.ToAccountID),
+		strconv.FormatInt(entry.Amount, 10),
+		entry.Currency,
+		strconv.FormatInt(balance, 10),
+	})
+	return s.w.Error()
+}
+
+func (s *csvStatement) Flush() error {
+	s.w.Flush()
+	return s.w.Error()
+}
+
+func (s *csvStatement) Closing(balance int64) error {
+	s.w.Write([]string{"closing", "", s.to.Format(time.RFC3339), "", "", "", "", "", "", strconv.FormatInt(balance, 10)})
+	s.w.Flush()
+	return s.w.Error()
+}
+
+func optionalID(id *int64) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatInt(*id, 10)
+}
+
+// jsonlStatement writes one JSON object per line, tagged with a type of
+// opening, entry or closing.
+type jsonlStatement struct {
+	enc      *json.Encoder
+	from, to time.Time
+}
+
+func (s *jsonlStatement) Opening(balance int64) error {
+	return s.enc.Encode(gin.H{"type": "opening", "date": s.from, "balance": balance})
+}
+
+func (s *jsonlStatement) Entry(entry *model.Transaction, category string, balance int64) error {
+	return s.enc.Encode(gin.H{"type": "entry", "transaction": entry, "category": category, "balance": balance})
+}
+
+func (s *jsonlStatement) Flush() error {
+	return nil
+}
+
+func (s *jsonlStatement) Closing(balance int64) error {
+	return s.enc.Encode(gin.H{"type": "closing", "date": s.to, "balance": balance})
+}
+
+// ofxStatement writes an OFX 2 bank statement. OFX has no opening balance
+// element, so the opening balance is only used to derive the ledger balance.
+type ofxStatement struct {
+	w        io.Writer
+	account  *model.Account
+	from, to time.Time
+}
+
+const ofxTime = "20060102150405"
+
+func ofxEscape(value string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
+
+func (s *ofxStatement) Opening(balance int64) error {
+	_, err := fmt.Fprintf(s.w, `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+<BANKMSGSRSV1>
+<STMTTRNRS>
+<TRNUID>0</TRNUID>
+<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<STMTRS>
+<CURDEF>%s</CURDEF>
+<BANKACCTFROM><BANKID>EXAMPLE</BANKID><ACCTID>%d</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>
+<BANKTRANLIST>
+<DTSTART>%s</DTSTART>
+<DTEND>%s</DTEND>
+`, s.account.Currency, s.account.AccountID, s.from.Format(ofxTime), s.to.Format(ofxTime))
+	return err
+}
+
+func (s *ofxStatement) Entry(entry *model.Transaction, category string, balance int64) error {
+	kind := "CREDIT"
+	if entry.Amount < 0 {
+		kind = "DEBIT"
+	}
+
+	_, err := fmt.Fprintf(s.w, "<STMTTRN><TRNTYPE>%s</TRNTYPE><DTPOSTED>%s</DTPOSTED><TRNAMT>%s</TRNAMT><FITID>%d</FITID><NAME>%s</NAME><MEMO>%s</MEMO></STMTTRN>\n",
+		kind,
+		entry.TransactionDate.Format(ofxTime),
+		utils.FormatAmount(entry.Amount, entry.Currency),
+		entry.TransactionID,
+		ofxEscape(entry.Reference),
+		ofxEscape(category),
+	)
+	return err
+}
+
+func (s *ofxStatement) Flush() error {
+	return nil
+}
+
+func (s *ofxStatement) Closing(balance int64) error {
+	_, err := fmt.Fprintf(s.w, `</BANKTRANLIST>
+<LEDGERBAL><BALAMT>%s</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>
+</STMTRS>
+</STMTTRNRS>
+</BANKMSGSRSV1>
+</OFX>
+`, utils.FormatAmount(balance, s.account.Currency), s.to.Format(ofxTime))
+	return err
+}
+
+// Statement streams the caller's statement between from and to with the
+// opening balance, every entry with its running balance and the closing
+// balance. Rows are read with a cursor so the range is never held in memory.
+func (a *accountImplement) Statement(ctx *gin.Context) {
+	var account model.Account
+	accountID := ctx.GetInt64("account_id")
+
+	if err := a.db.First(&account, accountID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Data not found",
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	now := time.Now()
+	from, to := startOfMonth(now), now
+	if value := ctx.Query("from"); value != "" {
+		parsed, err := parseHistoryTime(value)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid from",
+			})
+			return
+		}
+		from = parsed
+	}
+	if value := ctx.Query("to"); value != "" {
+		parsed, err := parseHistoryEnd(value)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid to",
+			})
+			return
+		}
+		to = parsed
+	}
+	if !from.Before(to) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "from must be before to",
+		})
+		return
+	}
+
+	format := ctx.DefaultQuery("format", "csv")
+	writer, contentType, ok := newStatementWriter(format, ctx.Writer, &account, from, to)
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "format must be csv, jsonl or ofx",
+		})
+		return
+	}
+
+	// the opening balance and the rows come from one snapshot, otherwise a
+	// transfer landing in between would be counted twice or not at all
+	tx := a.db.Begin(&sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if tx.Error != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": tx.Error.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	// the opening balance is worked back from the current balance, so it
+	// stays right for accounts whose early history has been archived
+	var opening int64
+	if err := tx.Model(&model.Account{}).
+		Where("account_id = ?", accountID).
+		Select(`balance - COALESCE((SELECT SUM(amount) FROM "transaction" WHERE account_id = ? AND transaction_date >= ?), 0)`, accountID, from).
+		Scan(&opening).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var categories []model.TransactionCategory
+	if err := tx.Find(&categories).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	categoryNames := make(map[int64]string, len(categories))
+	for _, category := range categories {
+		categoryNames[category.TransactionCategoryID] = category.Name
+	}
+
+	rows, err := tx.Model(&model.Transaction{}).
+		Where("account_id = ? AND transaction_date >= ? AND transaction_date < ?", accountID, from, to).
+		Order("transaction_date, transaction_id").
+		Rows()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("statement-%d-%s-%s.%s", accountID, from.Format("20060102"), to.Format("20060102"), format)
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	ctx.Status(http.StatusOK)
+
+	// once the body has started the status can't change any more, so a
+	// failure from here on only cuts the statement short
+	balance := opening
+	if err := writer.Opening(opening); err != nil {
+		log.Printf("statement %d: %v", accountID, err)
+		return
+	}
+
+	for written := 1; rows.Next(); written++ {
+		entry := model.Transaction{}
+		if err := tx.ScanRows(rows, &entry); err != nil {
+			log.Printf("statement %d: %v", accountID, err)
+			return
+		}
+
+		balance += entry.Amount
+		if err := writer.Entry(&entry, categoryNames[entry.TransactionCategoryID], balance); err != nil {
+			log.Printf("statement %d: %v", accountID, err)
+			return
+		}
+
+		if written%statementFlushEvery == 0 {
+			if err := writer.Flush(); err != nil {
+				log.Printf("statement %d: %v", accountID, err)
+				return
+			}
+			ctx.Writer.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("statement %d: %v", accountID, err)
+		return
+	}
+
+	if err := writer.Closing(balance); err != nil {
+		log.Printf("statement %d: %v", accountID, err)
+	}
+}
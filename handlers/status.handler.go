@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"example/model"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Account statuses. Only active accounts can move money; a closed account
+// stays closed.
+const (
+	accountActive = "active"
+	accountFrozen = "frozen"
+	accountClosed = "closed"
+)
+
+// accountTransitions lists the statuses each status may move to.
+var accountTransitions = map[string][]string{
+	accountActive: {accountFrozen, accountClosed},
+	accountFrozen: {accountActive},
+}
+
+var (
+	errStatusTransition = errors.New("account status can't change that way")
+	errAccountNotEmpty  = errors.New("only an account with a zero balance can be closed")
+)
+
+type statusPayload struct {
+	Status string `json:"status" binding:"required,oneof=active frozen closed"`
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// adminStatusPayload names the staff member behind an admin status change,
+// since the admin key alone doesn't say who used it.
+type adminStatusPayload struct {
+	statusPayload
+	ChangedBy string `json:"changed_by" binding:"required,max=100"`
+}
+
+// changeStatus moves a locked account to a new status and records who did it
+// and why. It must run inside tx.
+func changeStatus(tx *gorm.DB, accountID int64, status, reason, changedBy string) (*model.Account, error) {
+	accounts, err := lockAccounts(tx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	account := accounts[accountID]
+
+	allowed := false
+	for _, next := range accountTransitions[account.Status] {
+		if next == status {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("%s to %s: %w", account.Status, status, errStatusTransition)
+	}
+
+	if status == accountClosed && account.Balance != 0 {
+		return nil, errAccountNotEmpty
+	}
+
+	change := model.AccountStatusChange{
+		AccountID:  accountID,
+		FromStatus: account.Status,
+		ToStatus:   status,
+		Reason:     reason,
+		ChangedBy:  changedBy,
+		CreatedAt:  time.Now(),
+	}
+	if err := tx.Create(&change).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(account).Update("status", status).Error; err != nil {
+		return nil, err
+	}
+	account.Status = status
+
+	return account, nil
+}
+
+// runStatusChange applies a status change in its own transaction and writes
+// the response.
+func (a *accountImplement) runStatusChange(ctx *gin.Context, accountID int64, status, reason, changedBy string) {
+	tx := a.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	account, err := changeStatus(tx, accountID, status, reason, changedBy)
+	if err != nil {
+		tx.Rollback()
+		abortWithLedgerError(ctx, err)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Update success",
+		"data":    account,
+	})
+}
+
+// SetStatus freezes, unfreezes or closes any account. It is meant for
+// support staff behind the admin key.
+func (a *accountImplement) SetStatus(ctx *gin.Context) {
+	payload := adminStatusPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid account id",
+		})
+		return
+	}
+
+	a.runStatusChange(ctx, id, payload.Status, payload.Reason, payload.ChangedBy)
+}
+
+// StatusHistory returns the caller's current status and every change to it,
+// newest first.
+func (a *accountImplement) StatusHistory(ctx *gin.Context) {
+	var account model.Account
+	accountID := ctx.GetInt64("account_id")
+
+	if err := a.db.First(&account, accountID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Data not found",
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var changes []model.AccountStatusChange
+	if err := a.db.Where("account_id = ?", accountID).Order("account_status_change_id DESC").Find(&changes).Error; err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status": account.Status,
+		"data":   changes,
+	})
+}
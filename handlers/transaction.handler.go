@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"encoding/base64"
+	"errors"
 	"example/model"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -10,6 +16,9 @@ import (
 
 type transactionInterface interface {
 	LastTransaction(*gin.Context)
+	History(*gin.Context)
+	Reverse(*gin.Context)
+	SetCategory(*gin.Context)
 }
 
 type transactionImplement struct {
@@ -22,17 +31,21 @@ func NewTransaction(db *gorm.DB) transactionInterface {
 	}
 }
 
+// LastTransaction returns the latest entry of the caller's account.
 func (a *transactionImplement) LastTransaction(ctx *gin.Context) {
 	var lastTransaction []model.Transaction
 
-	id := ctx.Param("id")
-	if err := a.db.Where("account_id= ?", id).Last(&lastTransaction).Error; err != nil {
+	accountID := ctx.GetInt64("account_id")
+	if err := a.db.Where("account_id = ?", accountID).Last(&lastTransaction).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
 				"error": "ID not found",
 			})
 			return
 		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
 		return
 	}
 
@@ -41,3 +54,317 @@ func (a *transactionImplement) LastTransaction(ctx *gin.Context) {
 		"transaction": lastTransaction,
 	})
 }
+
+const (
+	historyDefaultLimit = 20
+	historyMaxLimit     = 100
+)
+
+// historyCursor points at the last row of a history page. The next page
+// continues strictly after it in (transaction_date, transaction_id) order.
+type historyCursor struct {
+	Date time.Time
+	ID   int64
+}
+
+func (c historyCursor) encode() string {
+	raw := fmt.Sprintf("%s|%d", c.Date.Format(time.RFC3339Nano), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeHistoryCursor(value string) (historyCursor, error) {
+	cursor := historyCursor{}
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, errors.New("invalid cursor")
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return cursor, errors.New("invalid cursor")
+	}
+
+	if cursor.Date, err = time.Parse(time.RFC3339Nano, parts[0]); err != nil {
+		return cursor, errors.New("invalid cursor")
+	}
+	if cursor.ID, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return cursor, errors.New("invalid cursor")
+	}
+
+	return cursor, nil
+}
+
+// parseHistoryTime accepts either a full RFC 3339 timestamp or a plain date.
+func parseHistoryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// parseHistoryEnd parses the exclusive end of a range. A plain date
+// includes the whole day, a timestamp is excluded itself.
+func parseHistoryEnd(value string) (time.Time, error) {
+	t, err := parseHistoryTime(value)
+	if err != nil {
+		return t, err
+	}
+	if len(value) == len(time.DateOnly) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// historyQuery applies the filters of a history request to query. Amount
+// filters compare against the absolute amount, direction "in" selects
+// credits and "out" selects debits.
+func historyQuery(ctx *gin.Context, query *gorm.DB) (*gorm.DB, error) {
+	if value := ctx.Query("from"); value != "" {
+		from, err := parseHistoryTime(value)
+		if err != nil {
+			return nil, errors.New("invalid from")
+		}
+		query = query.Where("transaction_date >= ?", from)
+	}
+
+	if value := ctx.Query("to"); value != "" {
+		to, err := parseHistoryEnd(value)
+		if err != nil {
+			return nil, errors.New("invalid to")
+		}
+		query = query.Where("transaction_date < ?", to)
+	}
+
+	if value := ctx.Query("min_amount"); value != "" {
+		amount, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid min_amount")
+		}
+		query = query.Where("ABS(amount) >= ?", amount)
+	}
+
+	if value := ctx.Query("max_amount"); value != "" {
+		amount, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid max_amount")
+		}
+		query = query.Where("ABS(amount) <= ?", amount)
+	}
+
+	if value := ctx.Query("category_id"); value != "" {
+		categoryID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid category_id")
+		}
+		query = query.Where("transaction_category_id = ?", categoryID)
+	}
+
+	switch ctx.Query("direction") {
+	case "":
+	case "in":
+		query = query.Where("amount > 0")
+	case "out":
+		query = query.Where("amount < 0")
+	default:
+		return nil, errors.New("direction must be in or out")
+	}
+
+	return query, nil
+}
+
+func (a *transactionImplement) History(ctx *gin.Context) {
+	// get account_id from middleware auth
+	accountID := ctx.GetInt64("account_id")
+
+	limit := historyDefaultLimit
+	if value := ctx.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid limit",
+			})
+			return
+		}
+		limit = min(parsed, historyMaxLimit)
+	}
+
+	query, err := historyQuery(ctx, a.db.Where("account_id = ?", accountID))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if value := ctx.Query("cursor"); value != "" {
+		cursor, err := decodeHistoryCursor(value)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		query = query.Where("(transaction_date, transaction_id) < (?, ?)", cursor.Date, cursor.ID)
+	}
+
+	// fetch one extra row to know whether there is a next page
+	var transactions []model.Transaction
+	if err := query.Order("transaction_date DESC, transaction_id DESC").
+		Limit(limit + 1).
+		Find(&transactions).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	nextCursor := ""
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+		last := transactions[limit-1]
+		nextCursor = historyCursor{Date: last.TransactionDate, ID: last.TransactionID}.encode()
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":     "success",
+		"data":        transactions,
+		"next_cursor": nextCursor,
+	})
+}
+
+type reversePayload struct {
+	Amount int64 `json:"amount" binding:"gte=0"`
+}
+
+// Reverse refunds a transfer received by the caller, fully or in part. The
+// id may be either entry of the original transfer.
+func (a *transactionImplement) Reverse(ctx *gin.Context) {
+	payload := reversePayload{}
+	accountID := ctx.GetInt64("account_id")
+
+	// an empty body means a full refund
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&payload); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+
+	original := model.Transaction{}
+	if err := a.db.First(&original, "transaction_id = ?", ctx.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Not found",
+			})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// only the recipient can send the money back
+	if original.ToAccountID == nil || *original.ToAccountID != accountID {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Only the recipient can reverse a transaction",
+		})
+		return
+	}
+
+	tx := a.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	result, err := reverseTransfer(tx, original.Reference, payload.Amount)
+	if err != nil {
+		tx.Rollback()
+		abortWithLedgerError(ctx, err)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":     "Reverse success",
+		"amount":      result.Amount,
+		"reference":   result.Reference,
+		"reversal_of": original.Reference,
+	})
+}
+
+type setCategoryPayload struct {
+	CategoryID int64 `json:"transaction_category_id" binding:"required"`
+}
+
+// SetCategory files one of the caller's own entries under a system category
+// or a category the caller created. An entry can't be moved into a ledger
+// category other than its own kind.
+func (a *transactionImplement) SetCategory(ctx *gin.Context) {
+	payload := setCategoryPayload{}
+	accountID := ctx.GetInt64("account_id")
+
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	transaction := model.Transaction{}
+	if err := a.db.First(&transaction, "transaction_id = ? AND account_id = ?", ctx.Param("id"), accountID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Not found",
+			})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	category, err := usableCategory(a.db, accountID, payload.CategoryID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Category not found",
+			})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !canFile(category, transaction.Kind) {
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Entries can't be moved into another ledger category",
+		})
+		return
+	}
+
+	if err := a.db.Model(&transaction).Update("transaction_category_id", payload.CategoryID).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Update success",
+		"data":    transaction,
+	})
+}
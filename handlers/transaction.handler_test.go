@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"bytes"
+	"example/model"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestSetCategoryKeepsLimits refiles a transfer debit the way a user would and
+// checks that it still counts toward the transfer limits, and that it can't
+// be passed off as a fee.
+func TestSetCategoryKeepsLimits(t *testing.T) {
+	db := testDB(t)
+	gin.SetMode(gin.TestMode)
+
+	defer SetHouseAccount(houseAccountID)
+	SetHouseAccount(0)
+
+	sender := openTestAccount(t, db, "IDR", 1000000)
+	recipient := openTestAccount(t, db, "IDR", 0)
+
+	tx := db.Begin()
+	result, err := transferFunds(tx, categoryTransfer, sender, recipient, 100000, "dinner")
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		t.Fatal(err)
+	}
+
+	debit := model.Transaction{}
+	if err := db.First(&debit, "reference = ? AND account_id = ?", result.Reference, sender).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	personal := model.TransactionCategory{Name: "Eating out", AccountID: &sender}
+	if err := db.Create(&personal).Error; err != nil {
+		t.Fatal(err)
+	}
+	feeID, err := categoryID(db, categoryFee)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setCategory := func(categoryID int64) int {
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Request = httptest.NewRequest(http.MethodPatch, "/transaction/category/"+strconv.FormatInt(debit.TransactionID, 10),
+			bytes.NewBufferString(fmt.Sprintf(`{"transaction_category_id": %d}`, categoryID)))
+		ctx.Request.Header.Set("Content-Type", "application/json")
+		ctx.Params = gin.Params{{Key: "id", Value: strconv.FormatInt(debit.TransactionID, 10)}}
+		ctx.Set("account_id", sender)
+
+		NewTransaction(db).SetCategory(ctx)
+		return recorder.Code
+	}
+
+	if code := setCategory(feeID); code != http.StatusConflict {
+		t.Errorf("filing a transfer as a fee returned %d, want %d", code, http.StatusConflict)
+	}
+	if code := setCategory(personal.TransactionCategoryID); code != http.StatusOK {
+		t.Fatalf("filing a transfer under a personal category returned %d", code)
+	}
+
+	used, err := usage(db, sender, limitTransfer, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used.DailyTotal != 100000 || used.DailyCount != 1 {
+		t.Errorf("refiled transfer counts as %d in %d transfers, want 100000 in 1", used.DailyTotal, used.DailyCount)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"example/database"
 	"example/handlers"
 	"example/middleware"
+	"example/model"
 	"example/utils"
 	"log"
 	"net/http"
@@ -33,11 +34,53 @@ func getDefaultConfig() Config {
 			"Accept",
 			"Authorization",
 			"X-Requested-With",
+			"Idempotency-Key",
+			"X-Admin-Key",
+			"X-Account-ID",
 		},
 		MaxAge: 12 * time.Hour,
 	}
 }
 
+// durationEnv reads a duration such as "90s" or "1h" from the environment,
+// falling back when the variable is not set.
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", name, err)
+	}
+	return duration
+}
+
+// stringEnv reads a string from the environment, falling back when the
+// variable is not set.
+func stringEnv(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// intEnv reads an integer from the environment, falling back when the
+// variable is not set.
+func intEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", name, err)
+	}
+	return number
+}
+
 func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Printf("Warning: Error loading .env file: %v", err)
@@ -55,6 +98,36 @@ func main() {
 		log.Fatal("JWTKEY environment variable is not set")
 	}
 
+	adminKey := os.Getenv("ADMINKEY")
+
+	if path := os.Getenv("EXCHANGE_RATE_FILE"); path != "" {
+		loaded, err := handlers.LoadExchangeRates(db, path)
+		if err != nil {
+			log.Fatal("Failed to load exchange rates:", err)
+		}
+		log.Printf("Loaded %d exchange rates from %s", loaded, path)
+	}
+
+	if err := handlers.SeedCategories(db); err != nil {
+		log.Fatal("Failed to seed transaction categories:", err)
+	}
+
+	// fees are paid into the house account and are off without one
+	if houseAccountID := intEnv("HOUSE_ACCOUNT_ID", 0); houseAccountID != 0 {
+		if err := db.First(&model.Account{}, houseAccountID).Error; err != nil {
+			log.Fatal("Failed to load house account:", err)
+		}
+		handlers.SetHouseAccount(int64(houseAccountID))
+	}
+
+	idempotencyTTL := durationEnv("IDEMPOTENCY_TTL", 24*time.Hour)
+
+	// the account an authenticated request acts on, picked with X-Account-ID,
+	// and the roles allowed to do it
+	member := middleware.AccountMemberMiddleware(db)
+	spender := middleware.AccountMemberMiddleware(db, model.RoleOwner, model.RoleSpender)
+	owner := middleware.AccountMemberMiddleware(db, model.RoleOwner)
+
 	r := gin.Default()
 
 	corsConfig := cors.Config{
@@ -107,27 +180,192 @@ func main() {
 	{
 		authRoutes.POST("/login", authHandler.AuthLogin)
 		authRoutes.POST("/signup", authHandler.AuthSignUp)
-		authRoutes.POST("/upsert", authHandler.Upsert)
+		authRoutes.POST("/upsert", middleware.AdminKeyMiddleware(adminKey), authHandler.Upsert)
 	}
 
 	accountHandler := handlers.NewAccount(db)
 	accountRoutes := r.Group("/account")
 	{
-		accountRoutes.POST("/create", accountHandler.Create)
-		accountRoutes.GET("/read/:id", accountHandler.Read)
-		accountRoutes.PATCH("/update/:id", middleware.AuthJWTMiddleware(jwtKey), accountHandler.Update)
-		accountRoutes.DELETE("/delete/:id", accountHandler.Delete)
-		accountRoutes.GET("/list", accountHandler.List)
-		accountRoutes.GET("/my", middleware.AuthJWTMiddleware(jwtKey), accountHandler.My)
-		accountRoutes.POST("/topup/:id", accountHandler.TopUp)
-		accountRoutes.GET("/balance", middleware.AuthJWTMiddleware(jwtKey), accountHandler.Balance)
-		accountRoutes.POST("/transfer", middleware.AuthJWTMiddleware(jwtKey), accountHandler.Transfer)
+		accountRoutes.POST("/create", middleware.AuthJWTMiddleware(jwtKey), accountHandler.Create)
+		accountRoutes.GET("/read/:id", middleware.AuthJWTMiddleware(jwtKey), member, accountHandler.Read)
+		accountRoutes.PATCH("/update/:id", middleware.AuthJWTMiddleware(jwtKey), owner, accountHandler.Update)
+		accountRoutes.DELETE("/delete/:id", middleware.AuthJWTMiddleware(jwtKey), owner, accountHandler.Delete)
+		accountRoutes.GET("/list", middleware.AdminKeyMiddleware(adminKey), accountHandler.List)
+		accountRoutes.GET("/my", middleware.AuthJWTMiddleware(jwtKey), member, accountHandler.My)
+		accountRoutes.POST("/topup/:id", middleware.AuthJWTMiddleware(jwtKey), owner, middleware.IdempotencyMiddleware(db, idempotencyTTL), accountHandler.TopUp)
+		accountRoutes.GET("/balance", middleware.AuthJWTMiddleware(jwtKey), member, accountHandler.Balance)
+		accountRoutes.POST("/transfer", middleware.AuthJWTMiddleware(jwtKey), spender, middleware.IdempotencyMiddleware(db, idempotencyTTL), accountHandler.Transfer)
+		accountRoutes.POST("/withdraw", middleware.AuthJWTMiddleware(jwtKey), spender, middleware.IdempotencyMiddleware(db, idempotencyTTL), accountHandler.Withdraw)
+		accountRoutes.GET("/limits", middleware.AuthJWTMiddleware(jwtKey), member, accountHandler.Limits)
+		accountRoutes.GET("/statement", middleware.AuthJWTMiddleware(jwtKey), member, accountHandler.Statement)
+		accountRoutes.GET("/analytics", middleware.AuthJWTMiddleware(jwtKey), member, accountHandler.Analytics)
+		accountRoutes.GET("/status", middleware.AuthJWTMiddleware(jwtKey), member, accountHandler.StatusHistory)
+	}
+
+	pocketHandler := handlers.NewPocket(db)
+	pocketRoutes := accountRoutes.Group("/pocket", middleware.AuthJWTMiddleware(jwtKey))
+	{
+		pocketRoutes.POST("", spender, pocketHandler.Create)
+		pocketRoutes.GET("", member, pocketHandler.List)
+		pocketRoutes.PATCH("/:id", spender, pocketHandler.Rename)
+		pocketRoutes.POST("/:id/deposit", spender, middleware.IdempotencyMiddleware(db, idempotencyTTL), pocketHandler.Deposit)
+		pocketRoutes.POST("/:id/withdraw", spender, middleware.IdempotencyMiddleware(db, idempotencyTTL), pocketHandler.Withdraw)
+	}
+
+	memberHandler := handlers.NewMember(db)
+	accountRoutes.GET("/memberships", middleware.AuthJWTMiddleware(jwtKey), memberHandler.Accounts)
+	memberRoutes := accountRoutes.Group("/member", middleware.AuthJWTMiddleware(jwtKey))
+	{
+		memberRoutes.GET("", member, memberHandler.List)
+		memberRoutes.POST("/invite", owner, memberHandler.Invite)
+		memberRoutes.POST("/invite/:id/revoke", owner, memberHandler.Revoke)
+		memberRoutes.DELETE("/:auth_id", owner, memberHandler.Remove)
+	}
+
+	invitationRoutes := r.Group("/invitation", middleware.AuthJWTMiddleware(jwtKey))
+	{
+		invitationRoutes.GET("", memberHandler.Invitations)
+		invitationRoutes.POST("/:id/accept", memberHandler.Accept)
+		invitationRoutes.POST("/:id/decline", memberHandler.Decline)
+	}
+
+	scheduleHandler := handlers.NewSchedule(db)
+	scheduleRoutes := accountRoutes.Group("/schedule", middleware.AuthJWTMiddleware(jwtKey), spender)
+	{
+		scheduleRoutes.POST("", scheduleHandler.Create)
+		scheduleRoutes.GET("", scheduleHandler.List)
+		scheduleRoutes.GET("/:id", scheduleHandler.Read)
+		scheduleRoutes.PATCH("/:id", scheduleHandler.Update)
+		scheduleRoutes.DELETE("/:id", scheduleHandler.Delete)
+	}
+
+	paymentRequestHandler := handlers.NewPaymentRequest(db)
+	paymentRequestRoutes := accountRoutes.Group("/request", middleware.AuthJWTMiddleware(jwtKey))
+	{
+		paymentRequestRoutes.POST("", spender, paymentRequestHandler.Create)
+		paymentRequestRoutes.GET("", member, paymentRequestHandler.List)
+		paymentRequestRoutes.POST("/:id/accept", spender, middleware.IdempotencyMiddleware(db, idempotencyTTL), paymentRequestHandler.Accept)
+		paymentRequestRoutes.POST("/:id/decline", spender, paymentRequestHandler.Decline)
+		paymentRequestRoutes.POST("/:id/cancel", spender, paymentRequestHandler.Cancel)
+	}
+
+	billSplitHandler := handlers.NewBillSplit(db)
+	billSplitRoutes := accountRoutes.Group("/split", middleware.AuthJWTMiddleware(jwtKey))
+	{
+		billSplitRoutes.POST("", spender, billSplitHandler.Create)
+		billSplitRoutes.GET("", member, billSplitHandler.List)
+		billSplitRoutes.GET("/:id", member, billSplitHandler.Read)
+	}
+
+	qrisHandler := handlers.NewQRIS(db, handlers.QRISConfig{
+		GUID: stringEnv("QRIS_GUID", "ID.CO.EXAMPLE.WWW"),
+		City: stringEnv("QRIS_CITY", "JAKARTA"),
+	})
+	qrisRoutes := accountRoutes.Group("/qr", middleware.AuthJWTMiddleware(jwtKey))
+	{
+		qrisRoutes.GET("", member, qrisHandler.Payload)
+		qrisRoutes.POST("/pay", spender, middleware.IdempotencyMiddleware(db, idempotencyTTL), qrisHandler.Pay)
+	}
+
+	holdHandler := handlers.NewHold(db)
+	holdRoutes := accountRoutes.Group("/hold", middleware.AuthJWTMiddleware(jwtKey), spender)
+	{
+		holdRoutes.POST("", holdHandler.Create)
+		holdRoutes.GET("", holdHandler.List)
+		holdRoutes.POST("/:id/capture", middleware.IdempotencyMiddleware(db, idempotencyTTL), holdHandler.Capture)
+		holdRoutes.POST("/:id/void", holdHandler.Void)
+	}
+
+	batchHandler := handlers.NewBatch(db)
+	batchRoutes := accountRoutes.Group("/batch", middleware.AuthJWTMiddleware(jwtKey), spender)
+	{
+		batchRoutes.POST("", middleware.IdempotencyMiddleware(db, idempotencyTTL), batchHandler.Create)
+		batchRoutes.GET("", batchHandler.List)
+		batchRoutes.GET("/:id", batchHandler.Read)
+	}
+
+	scheduleWorker := handlers.NewScheduleWorker(db, handlers.ScheduleRetryPolicy{
+		MaxRetries: intEnv("SCHEDULE_MAX_RETRIES", 3),
+		Delay:      durationEnv("SCHEDULE_RETRY_DELAY", time.Hour),
+	})
+	scheduleWorker.Start(durationEnv("SCHEDULE_POLL_INTERVAL", time.Minute))
+
+	interestWorker := handlers.NewInterestWorker(db)
+	interestWorker.Start(durationEnv("INTEREST_POLL_INTERVAL", time.Hour))
+
+	paymentRequestWorker := handlers.NewPaymentRequestWorker(db)
+	paymentRequestWorker.Start(durationEnv("REQUEST_EXPIRY_INTERVAL", time.Minute))
+
+	exchangeRateHandler := handlers.NewExchangeRate(db)
+	rateRoutes := r.Group("/rate")
+	{
+		rateRoutes.GET("/list", exchangeRateHandler.List)
+		rateRoutes.PUT("/upsert", middleware.AdminKeyMiddleware(adminKey), exchangeRateHandler.Upsert)
+	}
+
+	interestHandler := handlers.NewInterest(db)
+	interestRoutes := r.Group("/interest")
+	{
+		interestRoutes.GET("/tiers", interestHandler.Tiers)
+		interestRoutes.PUT("/tiers", middleware.AdminKeyMiddleware(adminKey), interestHandler.SetTiers)
+	}
+
+	feeHandler := handlers.NewFee(db)
+	feeRoutes := r.Group("/fee")
+	{
+		feeRoutes.GET("/rules", feeHandler.Rules)
+		feeRoutes.PUT("/rules", middleware.AdminKeyMiddleware(adminKey), feeHandler.SetRules)
+		feeRoutes.GET("/quote", middleware.AuthJWTMiddleware(jwtKey), member, feeHandler.Quote)
+	}
+
+	categoryHandler := handlers.NewCategory(db)
+	categoryRoutes := r.Group("/category")
+	{
+		categoryRoutes.GET("/list", categoryHandler.List)
+		categoryRoutes.POST("/create", middleware.AdminKeyMiddleware(adminKey), categoryHandler.Create)
+		categoryRoutes.PATCH("/rename/:id", middleware.AdminKeyMiddleware(adminKey), categoryHandler.Rename)
+		categoryRoutes.PATCH("/archive/:id", middleware.AdminKeyMiddleware(adminKey), categoryHandler.Archive)
+		categoryRoutes.GET("/my", middleware.AuthJWTMiddleware(jwtKey), member, categoryHandler.My)
+		categoryRoutes.POST("/my", middleware.AuthJWTMiddleware(jwtKey), spender, categoryHandler.CreateMy)
+	}
+
+	ruleHandler := handlers.NewRule(db)
+	ruleRoutes := r.Group("/rule", middleware.AuthJWTMiddleware(jwtKey), spender)
+	{
+		ruleRoutes.POST("/create", ruleHandler.Create)
+		ruleRoutes.GET("/list", ruleHandler.List)
+		ruleRoutes.DELETE("/delete/:id", ruleHandler.Delete)
+		ruleRoutes.POST("/preview", ruleHandler.Preview)
+		ruleRoutes.POST("/apply", ruleHandler.Apply)
+	}
+
+	budgetHandler := handlers.NewBudget(db)
+	budgetRoutes := r.Group("/budget", middleware.AuthJWTMiddleware(jwtKey), spender)
+	{
+		budgetRoutes.POST("/create", budgetHandler.Create)
+		budgetRoutes.GET("/list", budgetHandler.List)
+		budgetRoutes.PATCH("/update/:id", budgetHandler.Update)
+		budgetRoutes.DELETE("/delete/:id", budgetHandler.Delete)
+		budgetRoutes.GET("/status", budgetHandler.Status)
+		budgetRoutes.GET("/alerts", budgetHandler.Alerts)
+	}
+
+	reconcileHandler := handlers.NewReconcile(db)
+	adminRoutes := r.Group("/admin", middleware.AdminKeyMiddleware(adminKey))
+	{
+		adminRoutes.GET("/reconcile", reconcileHandler.Report)
+		adminRoutes.POST("/reconcile", reconcileHandler.Fix)
+		adminRoutes.POST("/account/:id/status", accountHandler.SetStatus)
+		adminRoutes.POST("/interest/run", interestHandler.Run)
 	}
 
 	transactionHandler := handlers.NewTransaction(db)
 	transactionRoutes := r.Group("/transaction")
 	{
-		transactionRoutes.GET("/last/:id", transactionHandler.LastTransaction)
+		transactionRoutes.GET("/last", middleware.AuthJWTMiddleware(jwtKey), member, transactionHandler.LastTransaction)
+		transactionRoutes.GET("/history", middleware.AuthJWTMiddleware(jwtKey), member, transactionHandler.History)
+		transactionRoutes.PATCH("/category/:id", middleware.AuthJWTMiddleware(jwtKey), spender, transactionHandler.SetCategory)
+		transactionRoutes.POST("/reverse/:id", middleware.AuthJWTMiddleware(jwtKey), spender, middleware.IdempotencyMiddleware(db, idempotencyTTL), transactionHandler.Reverse)
 	}
 
 	port := os.Getenv("PORT")
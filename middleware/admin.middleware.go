@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminKeyMiddleware only lets through requests whose X-Admin-Key header
+// matches adminKey. When adminKey is empty every request is refused.
+func AdminKeyMiddleware(adminKey string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader("X-Admin-Key")
+
+		if adminKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) != 1 {
+			ctx.JSON(http.StatusForbidden, gin.H{
+				"error": "Forbidden",
+			})
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"example/model"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// responseRecorder keeps a copy of everything written to the response so it
+// can be stored for replay.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware makes a handler safe to retry. When a request carries
+// an Idempotency-Key header, the first response for that key is stored and
+// replayed for every repeat within ttl. Reusing a key with a different body
+// is rejected. Requests without the header pass through untouched.
+//
+// Keys are scoped by method, path and the account_id set by
+// AuthJWTMiddleware or AccountMemberMiddleware, so it must run after them on
+// authenticated routes.
+func IdempotencyMiddleware(db *gorm.DB, ttl time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader("Idempotency-Key")
+		if key == "" {
+			ctx.Next()
+			return
+		}
+
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.Sum256(body)
+		now := time.Now()
+		record := model.IdempotencyKey{
+			Key:         key,
+			Scope:       fmt.Sprintf("%s %s %d", ctx.Request.Method, ctx.Request.URL.Path, ctx.GetInt64("account_id")),
+			RequestHash: hex.EncodeToString(hash[:]),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(ttl),
+		}
+
+		// an expired key is forgotten and may be used again
+		if err := db.Where("scope = ? AND key = ? AND expires_at <= ?", record.Scope, record.Key, now).
+			Delete(&model.IdempotencyKey{}).Error; err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// claim the key; the unique (scope, key) constraint lets only one
+		// request through when several retries arrive at the same time
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if result.Error != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": result.Error.Error(),
+			})
+			return
+		}
+
+		if result.RowsAffected == 0 {
+			existing := model.IdempotencyKey{}
+			if err := db.Where("scope = ? AND key = ?", record.Scope, record.Key).First(&existing).Error; err != nil {
+				ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+
+			if existing.RequestHash != record.RequestHash {
+				ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+					"error": "Idempotency-Key was already used with a different payload",
+				})
+				return
+			}
+
+			if existing.StatusCode == 0 {
+				ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+					"error": "A request with this Idempotency-Key is still in progress",
+				})
+				return
+			}
+
+			ctx.Header("Idempotent-Replayed", "true")
+			ctx.Data(existing.StatusCode, "application/json; charset=utf-8", []byte(existing.ResponseBody))
+			ctx.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: ctx.Writer, body: &bytes.Buffer{}}
+		ctx.Writer = recorder
+
+		// the claim is released when the handler panics, so the key isn't
+		// stuck in progress until it expires
+		defer func() {
+			if r := recover(); r != nil {
+				releaseIdempotencyKey(db, &record)
+				panic(r)
+			}
+		}()
+
+		ctx.Next()
+
+		// server errors are not stored so the client can retry with the same key
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			releaseIdempotencyKey(db, &record)
+			return
+		}
+
+		if err := db.Model(&model.IdempotencyKey{}).
+			Where("idempotency_key_id = ?", record.IdempotencyKeyID).
+			Updates(map[string]interface{}{
+				"status_code":   status,
+				"response_body": recorder.body.String(),
+			}).Error; err != nil {
+			// the handler already ran, so the key stays claimed rather
+			// than letting a retry run it a second time
+			log.Printf("idempotency key %q: storing response: %v", record.Key, err)
+		}
+	}
+}
+
+// releaseIdempotencyKey deletes a claimed key so the request can be retried
+// with it.
+func releaseIdempotencyKey(db *gorm.DB, record *model.IdempotencyKey) {
+	if err := db.Delete(&model.IdempotencyKey{}, record.IdempotencyKeyID).Error; err != nil {
+		log.Printf("idempotency key %q: releasing: %v", record.Key, err)
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"example/model"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AccountMemberMiddleware picks the account a request acts on and checks the
+// caller may act on it. The account comes from the X-Account-ID header and
+// defaults to the account_id of the token. Either way the caller needs an
+// account_member row on it with one of roles, or any role when none are
+// given.
+//
+// The resolved account replaces account_id in the context and the role is
+// set as account_role, so it must run after AuthJWTMiddleware and before
+// IdempotencyMiddleware.
+func AccountMemberMiddleware(db *gorm.DB, roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authID := ctx.GetInt64("auth_id")
+		accountID := ctx.GetInt64("account_id")
+		if value := ctx.GetHeader("X-Account-ID"); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"error": "Invalid X-Account-ID",
+				})
+				return
+			}
+			accountID = parsed
+		}
+
+		member := model.AccountMember{}
+		result := db.Where("account_id = ? AND auth_id = ?", accountID, authID).Limit(1).Find(&member)
+		if result.Error != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": result.Error.Error(),
+			})
+			return
+		}
+
+		if result.RowsAffected == 0 {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Not a member of this account",
+			})
+			return
+		}
+		role := member.Role
+
+		if len(roles) > 0 {
+			allowed := false
+			for _, r := range roles {
+				if r == role {
+					allowed = true
+				}
+			}
+			if !allowed {
+				ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error": "Your role on this account does not allow this",
+				})
+				return
+			}
+		}
+
+		ctx.Set("account_id", accountID)
+		ctx.Set("account_role", role)
+		ctx.Next()
+	}
+}
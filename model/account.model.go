@@ -4,6 +4,9 @@ type Account struct {
 	AccountID int64  `json:"account_id" gorm:"primaryKey;autoIncrement;<-:false"`
 	Name      string `json:"name"`
 	Balance   int64  `json:"balance"`
+	Currency  string `json:"currency"`
+	Tier      string `json:"tier" gorm:"<-:false"`
+	Status    string `json:"status" gorm:"<-:update"`
 }
 
 func (Account) TableName() string {
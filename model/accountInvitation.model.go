@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+type AccountInvitation struct {
+	AccountInvitationID int64      `json:"account_invitation_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID           int64      `json:"account_id"`
+	AuthID              int64      `json:"auth_id"`
+	Role                string     `json:"role"`
+	InvitedBy           int64      `json:"invited_by"`
+	Status              string     `json:"status"`
+	CreatedAt           time.Time  `json:"created_at"`
+	RespondedAt         *time.Time `json:"responded_at"`
+}
+
+func (AccountInvitation) TableName() string {
+	return "account_invitation"
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// Roles a user can have on an account. Owners manage members, spenders can
+// move money and viewers can only look.
+const (
+	RoleOwner   = "owner"
+	RoleSpender = "spender"
+	RoleViewer  = "viewer"
+)
+
+type AccountMember struct {
+	AccountID int64     `json:"account_id" gorm:"primaryKey"`
+	AuthID    int64     `json:"auth_id" gorm:"primaryKey"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (AccountMember) TableName() string {
+	return "account_member"
+}
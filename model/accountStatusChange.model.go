@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// AccountStatusChange records who moved an account between statuses and why.
+type AccountStatusChange struct {
+	AccountStatusChangeID int64     `json:"account_status_change_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID             int64     `json:"account_id"`
+	FromStatus            string    `json:"from_status"`
+	ToStatus              string    `json:"to_status"`
+	Reason                string    `json:"reason"`
+	ChangedBy             string    `json:"changed_by"`
+	CreatedAt             time.Time `json:"created_at"`
+}
+
+func (AccountStatusChange) TableName() string {
+	return "account_status_change"
+}
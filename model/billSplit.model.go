@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// BillSplit is an expense the originating account shares with others. Mode
+// is how Total was divided: equal, percent or exact.
+type BillSplit struct {
+	BillSplitID int64     `json:"bill_split_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID   int64     `json:"account_id"`
+	Total       int64     `json:"total"`
+	Currency    string    `json:"currency"`
+	Mode        string    `json:"mode"`
+	Note        string    `json:"note"`
+	CreatedBy   int64     `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (BillSplit) TableName() string {
+	return "bill_split"
+}
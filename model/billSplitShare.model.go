@@ -0,0 +1,15 @@
+package model
+
+// BillSplitShare is what one participant owes of a bill split. The
+// originator's own share has no payment request.
+type BillSplitShare struct {
+	BillSplitShareID int64  `json:"bill_split_share_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	BillSplitID      int64  `json:"bill_split_id"`
+	AccountID        int64  `json:"account_id"`
+	Amount           int64  `json:"amount"`
+	PaymentRequestID *int64 `json:"payment_request_id"`
+}
+
+func (BillSplitShare) TableName() string {
+	return "bill_split_share"
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+type Budget struct {
+	BudgetID              int64     `json:"budget_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID             int64     `json:"account_id"`
+	TransactionCategoryID int64     `json:"transaction_category_id"`
+	Amount                int64     `json:"amount"`
+	Period                string    `json:"period"`
+	CreatedAt             time.Time `json:"created_at"`
+}
+
+func (Budget) TableName() string {
+	return "budget"
+}
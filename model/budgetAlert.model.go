@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+type BudgetAlert struct {
+	BudgetAlertID int64     `json:"budget_alert_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	BudgetID      int64     `json:"budget_id"`
+	AccountID     int64     `json:"account_id"`
+	PeriodStart   time.Time `json:"period_start"`
+	Threshold     int       `json:"threshold"`
+	Spent         int64     `json:"spent"`
+	Reference     string    `json:"reference"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (BudgetAlert) TableName() string {
+	return "budget_alert"
+}
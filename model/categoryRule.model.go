@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// CategoryRule assigns a category to an account's entries. Every condition
+// that is set must match; unset conditions match anything. Amount bounds
+// compare against the absolute amount and DayOfWeek counts from Sunday = 0.
+type CategoryRule struct {
+	CategoryRuleID        int64     `json:"category_rule_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID             int64     `json:"account_id"`
+	TransactionCategoryID int64     `json:"transaction_category_id"`
+	CounterpartyAccountID *int64    `json:"counterparty_account_id"`
+	MinAmount             *int64    `json:"min_amount"`
+	MaxAmount             *int64    `json:"max_amount"`
+	MemoContains          *string   `json:"memo_contains"`
+	DayOfWeek             *int      `json:"day_of_week"`
+	Priority              int       `json:"priority"`
+	CreatedAt             time.Time `json:"created_at"`
+}
+
+func (CategoryRule) TableName() string {
+	return "category_rule"
+}
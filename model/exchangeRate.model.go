@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+type ExchangeRate struct {
+	ExchangeRateID int64     `json:"exchange_rate_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	BaseCurrency   string    `json:"base_currency"`
+	QuoteCurrency  string    `json:"quote_currency"`
+	Rate           string    `json:"rate"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func (ExchangeRate) TableName() string {
+	return "exchange_rate"
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// FeeCharge records the fee evaluated for one operation, including operations
+// that were free. FeeReference is the fee's own journal entry and is nil when
+// nothing was charged.
+type FeeCharge struct {
+	FeeChargeID  int64     `json:"fee_charge_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID    int64     `json:"account_id"`
+	Operation    string    `json:"operation"`
+	Reference    string    `json:"reference"`
+	Amount       int64     `json:"amount"`
+	Fee          int64     `json:"fee"`
+	Free         bool      `json:"free"`
+	FeeReference *string   `json:"fee_reference"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (FeeCharge) TableName() string {
+	return "fee_charge"
+}
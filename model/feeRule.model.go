@@ -0,0 +1,20 @@
+package model
+
+// FeeRule prices one operation in a currency for amounts from MinAmount up to
+// the next rule's MinAmount. The fee is Flat plus Percent of the amount, a
+// decimal fraction such as "0.005", kept between MinFee and MaxFee. A zero
+// MaxFee means no cap. The first FreePerMonth operations of a month are free.
+type FeeRule struct {
+	Operation    string `json:"operation" gorm:"primaryKey"`
+	Currency     string `json:"currency" gorm:"primaryKey"`
+	MinAmount    int64  `json:"min_amount" gorm:"primaryKey;autoIncrement:false"`
+	Flat         int64  `json:"flat"`
+	Percent      string `json:"percent"`
+	MinFee       int64  `json:"min_fee"`
+	MaxFee       int64  `json:"max_fee"`
+	FreePerMonth int64  `json:"free_per_month"`
+}
+
+func (FeeRule) TableName() string {
+	return "fee_rule"
+}
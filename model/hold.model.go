@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+type Hold struct {
+	HoldID            int64     `json:"hold_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID         int64     `json:"account_id"`
+	MerchantAccountID int64     `json:"merchant_account_id"`
+	Amount            int64     `json:"amount"`
+	CapturedAmount    int64     `json:"captured_amount"`
+	Status            string    `json:"status"`
+	Reference         *string   `json:"reference"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+func (Hold) TableName() string {
+	return "hold"
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+type IdempotencyKey struct {
+	IdempotencyKeyID int64     `json:"idempotency_key_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Key              string    `json:"key"`
+	Scope            string    `json:"scope"`
+	RequestHash      string    `json:"request_hash"`
+	StatusCode       int       `json:"status_code"`
+	ResponseBody     string    `json:"response_body"`
+	CreatedAt        time.Time `json:"created_at"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+func (IdempotencyKey) TableName() string {
+	return "idempotency_key"
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// InterestAccrual carries the interest an account has earned but that has
+// not been posted yet. Accrued is an exact fraction of a minor unit, such as
+// "1234567/365".
+type InterestAccrual struct {
+	AccountID      int64     `json:"account_id" gorm:"primaryKey;autoIncrement:false"`
+	Accrued        string    `json:"accrued"`
+	AccruedThrough time.Time `json:"accrued_through"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func (InterestAccrual) TableName() string {
+	return "interest_accrual"
+}
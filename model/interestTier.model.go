@@ -0,0 +1,14 @@
+package model
+
+// InterestTier is one balance band of a currency's interest rates. The part
+// of a balance from MinBalance up to the next tier's MinBalance earns
+// AnnualRate, a decimal fraction such as "0.025" for 2.5% a year.
+type InterestTier struct {
+	Currency   string `json:"currency" gorm:"primaryKey"`
+	MinBalance int64  `json:"min_balance" gorm:"primaryKey"`
+	AnnualRate string `json:"annual_rate"`
+}
+
+func (InterestTier) TableName() string {
+	return "interest_tier"
+}
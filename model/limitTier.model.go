@@ -0,0 +1,17 @@
+package model
+
+// LimitTier holds the velocity limits of one operation for accounts on a
+// tier in one currency, in its minor units. A zero limit means unlimited.
+type LimitTier struct {
+	Tier              string `json:"tier" gorm:"primaryKey"`
+	Operation         string `json:"operation" gorm:"primaryKey"`
+	Currency          string `json:"currency" gorm:"primaryKey"`
+	PerTransactionMax int64  `json:"per_transaction_max"`
+	DailyTotal        int64  `json:"daily_total"`
+	MonthlyTotal      int64  `json:"monthly_total"`
+	DailyCount        int64  `json:"daily_count"`
+}
+
+func (LimitTier) TableName() string {
+	return "limit_tier"
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// PaymentRequest asks the payer account to send Amount to the requester
+// account. Reference is the transfer that paid it.
+type PaymentRequest struct {
+	PaymentRequestID   int64      `json:"payment_request_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	RequesterAccountID int64      `json:"requester_account_id"`
+	PayerAccountID     int64      `json:"payer_account_id"`
+	Amount             int64      `json:"amount"`
+	Currency           string     `json:"currency"`
+	Note               string     `json:"note"`
+	Status             string     `json:"status"`
+	Reference          *string    `json:"reference"`
+	RequestedBy        int64      `json:"requested_by"`
+	ExpiresAt          time.Time  `json:"expires_at"`
+	RespondedAt        *time.Time `json:"responded_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+func (PaymentRequest) TableName() string {
+	return "payment_request"
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// Pocket earmarks part of an account's balance. The account balance always
+// includes the money in its pockets.
+type Pocket struct {
+	PocketID  int64     `json:"pocket_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID int64     `json:"account_id"`
+	Name      string    `json:"name"`
+	Balance   int64     `json:"balance"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (Pocket) TableName() string {
+	return "pocket"
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// QRISPayment records the payment of a dynamic QR code so it can't be paid
+// twice. CodeReference is the reference in the code's additional data and
+// Reference the journal entries of the transfer.
+type QRISPayment struct {
+	QRISPaymentID  int64     `json:"qris_payment_id" gorm:"column:qris_payment_id;primaryKey;autoIncrement;<-:false"`
+	AccountID      int64     `json:"account_id"`
+	CodeReference  string    `json:"code_reference"`
+	PayerAccountID int64     `json:"payer_account_id"`
+	Reference      string    `json:"reference"`
+	PaidAt         time.Time `json:"paid_at"`
+}
+
+func (QRISPayment) TableName() string {
+	return "qris_payment"
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+type Schedule struct {
+	ScheduleID      int64      `json:"schedule_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID       int64      `json:"account_id"`
+	TargetAccountID int64      `json:"target_account_id"`
+	Amount          int64      `json:"amount"`
+	IntervalUnit    string     `json:"interval_unit"`
+	IntervalCount   int        `json:"interval_count"`
+	StartAt         time.Time  `json:"start_at"`
+	NextRunAt       time.Time  `json:"next_run_at"`
+	EndDate         *time.Time `json:"end_date"`
+	Attempt         int        `json:"attempt"`
+	RetryAt         *time.Time `json:"retry_at"`
+	Status          string     `json:"status"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+func (Schedule) TableName() string {
+	return "schedule"
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+type ScheduleRun struct {
+	ScheduleRunID int64     `json:"schedule_run_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	ScheduleID    int64     `json:"schedule_id"`
+	DueAt         time.Time `json:"due_at"`
+	RunAt         time.Time `json:"run_at"`
+	Attempt       int       `json:"attempt"`
+	Status        string    `json:"status"`
+	Error         string    `json:"error"`
+	Reference     *string   `json:"reference"`
+}
+
+func (ScheduleRun) TableName() string {
+	return "schedule_run"
+}
@@ -1,13 +1,25 @@
 package model
 
+import "time"
+
+// Transaction is one journal entry. Kind is the ledger category the entry
+// was posted under and never changes, while TransactionCategoryID is where
+// the owner files it and may be moved by them or their rules.
 type Transaction struct {
-	TransactionID         int64 `json:"transaction_id" gorm:"primaryKey;autoIncrement;<-:false"`
-	TransactionCategoryID int64 `json:"transaction_category_id" gorm:"foreignKey:TransactionCategoryID;autoIncrement;<-:false"`
-	AccountID             int64 `json:"account_id"`
-	FromAccountID         int64 `json:"from_account_id"`
-	ToAccountID           int64 `json:"to_account_id"`
-	Amount                int64 `json:"amount"`
-	TransactionDate       int64 `json:"transaction_date"`
+	TransactionID         int64     `json:"transaction_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	TransactionCategoryID int64     `json:"transaction_category_id"`
+	Kind                  string    `json:"kind" gorm:"<-:create"`
+	AccountID             int64     `json:"account_id"`
+	FromAccountID         *int64    `json:"from_account_id"`
+	ToAccountID           *int64    `json:"to_account_id"`
+	PocketID              *int64    `json:"pocket_id"`
+	Amount                int64     `json:"amount"`
+	Currency              string    `json:"currency"`
+	ExchangeRate          *string   `json:"exchange_rate"`
+	Reference             string    `json:"reference"`
+	Memo                  string    `json:"memo"`
+	ReversalOf            *string   `json:"reversal_of"`
+	TransactionDate       time.Time `json:"transaction_date"`
 }
 
 func (Transaction) TableName() string {
@@ -1,8 +1,12 @@
 package model
 
+// TransactionCategory is either a system category (AccountID nil) shared by
+// everyone, or a category a user created for their own account.
 type TransactionCategory struct {
 	TransactionCategoryID int64  `json:"transaction_category_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID             *int64 `json:"account_id"`
 	Name                  string `json:"name"`
+	Archived              bool   `json:"archived"`
 }
 
 func (TransactionCategory) TableName() string {
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+type TransferBatch struct {
+	TransferBatchID int64     `json:"transfer_batch_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID       int64     `json:"account_id"`
+	Mode            string    `json:"mode"`
+	Status          string    `json:"status"`
+	TotalAmount     int64     `json:"total_amount"`
+	ItemCount       int       `json:"item_count"`
+	SucceededCount  int       `json:"succeeded_count"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+func (TransferBatch) TableName() string {
+	return "transfer_batch"
+}
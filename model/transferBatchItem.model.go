@@ -0,0 +1,16 @@
+package model
+
+type TransferBatchItem struct {
+	TransferBatchItemID int64   `json:"transfer_batch_item_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	TransferBatchID     int64   `json:"transfer_batch_id"`
+	Line                int     `json:"line"`
+	TargetAccountID     int64   `json:"target_account_id"`
+	Amount              int64   `json:"amount"`
+	Status              string  `json:"status"`
+	Error               string  `json:"error"`
+	Reference           *string `json:"reference"`
+}
+
+func (TransferBatchItem) TableName() string {
+	return "transfer_batch_item"
+}
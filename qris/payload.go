@@ -0,0 +1,260 @@
+package qris
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Tags of the root fields of a payload.
+const (
+	tagFormat       = "00"
+	tagInitiation   = "01"
+	tagCategoryCode = "52"
+	tagCurrency     = "53"
+	tagAmount       = "54"
+	tagCountry      = "58"
+	tagName         = "59"
+	tagCity         = "60"
+	tagPostalCode   = "61"
+	tagAdditional   = "62"
+	tagCRC          = "63"
+)
+
+// Point of initiation values. A static code can be paid many times with any
+// amount, a dynamic code is meant for one payment of its amount.
+const (
+	initiationStatic  = "11"
+	initiationDynamic = "12"
+)
+
+// Sub-fields of the additional data template (tag 62).
+const (
+	AdditionalBillNumber = "01"
+	AdditionalReference  = "05"
+	AdditionalPurpose    = "08"
+)
+
+// MerchantAccount is a merchant account information template, tags 26 to
+// 51. GUID is its sub-field 00 and names the network the account belongs
+// to; Fields are the other sub-fields, such as 01 for the merchant PAN.
+type MerchantAccount struct {
+	Tag    string  `json:"tag"`
+	GUID   string  `json:"guid"`
+	Fields []Field `json:"fields"`
+}
+
+// Get returns the value of a sub-field, or "" when it is missing.
+func (m MerchantAccount) Get(tag string) string {
+	return get(m.Fields, tag)
+}
+
+// Payload is a decoded merchant-presented QR code. Currency is the ISO 4217
+// numeric code and Amount a decimal in major units, such as "15000" or
+// "12.50"; it is empty on a static code that lets the payer choose.
+type Payload struct {
+	Dynamic      bool              `json:"dynamic"`
+	Accounts     []MerchantAccount `json:"accounts"`
+	CategoryCode string            `json:"category_code"`
+	Currency     string            `json:"currency"`
+	Amount       string            `json:"amount"`
+	CountryCode  string            `json:"country_code"`
+	MerchantName string            `json:"merchant_name"`
+	MerchantCity string            `json:"merchant_city"`
+	PostalCode   string            `json:"postal_code"`
+	// sub-fields of the additional data template, see Additional*
+	Additional []Field `json:"additional"`
+	// root fields this package doesn't interpret, such as tip indicators
+	Extra []Field `json:"extra"`
+}
+
+// Account returns the merchant account template of the network with guid.
+func (p *Payload) Account(guid string) (*MerchantAccount, bool) {
+	for i := range p.Accounts {
+		if p.Accounts[i].GUID == guid {
+			return &p.Accounts[i], true
+		}
+	}
+	return nil, false
+}
+
+// AdditionalData returns the value of a sub-field of the additional data
+// template, or "" when it is missing.
+func (p *Payload) AdditionalData(tag string) string {
+	return get(p.Additional, tag)
+}
+
+// Encode validates the payload and writes it as a QR string, fields in tag
+// order and closed by the CRC.
+func (p *Payload) Encode() (string, error) {
+	if len(p.Accounts) == 0 {
+		return "", errors.New("at least one merchant account is required")
+	}
+	if p.Dynamic && p.Amount == "" {
+		return "", errors.New("a dynamic code needs an amount")
+	}
+	if err := checkLength("category code", p.CategoryCode, 4, 4); err != nil {
+		return "", err
+	}
+	if err := checkLength("currency", p.Currency, 3, 3); err != nil {
+		return "", err
+	}
+	if err := checkLength("amount", p.Amount, 0, 13); err != nil {
+		return "", err
+	}
+	if err := checkLength("country code", p.CountryCode, 2, 2); err != nil {
+		return "", err
+	}
+	if err := checkLength("merchant name", p.MerchantName, 1, 25); err != nil {
+		return "", err
+	}
+	if err := checkLength("merchant city", p.MerchantCity, 1, 15); err != nil {
+		return "", err
+	}
+
+	initiation := initiationStatic
+	if p.Dynamic {
+		initiation = initiationDynamic
+	}
+
+	fields := []Field{
+		{Tag: tagFormat, Value: "01"},
+		{Tag: tagInitiation, Value: initiation},
+		{Tag: tagCategoryCode, Value: p.CategoryCode},
+		{Tag: tagCurrency, Value: p.Currency},
+		{Tag: tagCountry, Value: p.CountryCode},
+		{Tag: tagName, Value: p.MerchantName},
+		{Tag: tagCity, Value: p.MerchantCity},
+	}
+
+	for _, account := range p.Accounts {
+		if account.Tag < "26" || account.Tag > "51" {
+			return "", fmt.Errorf("merchant account tag %s is outside 26 to 51", account.Tag)
+		}
+
+		value, err := EncodeFields(append([]Field{{Tag: "00", Value: account.GUID}}, account.Fields...))
+		if err != nil {
+			return "", fmt.Errorf("merchant account %s: %w", account.Tag, err)
+		}
+		fields = append(fields, Field{Tag: account.Tag, Value: value})
+	}
+
+	if p.Amount != "" {
+		fields = append(fields, Field{Tag: tagAmount, Value: p.Amount})
+	}
+	if p.PostalCode != "" {
+		fields = append(fields, Field{Tag: tagPostalCode, Value: p.PostalCode})
+	}
+	if len(p.Additional) > 0 {
+		value, err := EncodeFields(p.Additional)
+		if err != nil {
+			return "", fmt.Errorf("additional data: %w", err)
+		}
+		fields = append(fields, Field{Tag: tagAdditional, Value: value})
+	}
+	for _, field := range p.Extra {
+		if field.Tag != tagCRC {
+			fields = append(fields, field)
+		}
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Tag < fields[j].Tag })
+
+	payload, err := EncodeFields(fields)
+	if err != nil {
+		return "", err
+	}
+	return appendCRC(payload), nil
+}
+
+// Decode checks the CRC of a QR string and reads its fields.
+func Decode(payload string) (*Payload, error) {
+	if err := checkCRC(payload); err != nil {
+		return nil, err
+	}
+
+	fields, err := DecodeFields(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < 2 || fields[0].Tag != tagFormat || fields[0].Value != "01" {
+		return nil, errors.New("payload does not start with format indicator 01")
+	}
+	if fields[len(fields)-1].Tag != tagCRC {
+		return nil, errors.New("payload does not end with a CRC")
+	}
+
+	p := Payload{}
+	for _, field := range fields[1 : len(fields)-1] {
+		switch {
+		case field.Tag == tagInitiation:
+			if field.Value != initiationStatic && field.Value != initiationDynamic {
+				return nil, fmt.Errorf("invalid point of initiation %q", field.Value)
+			}
+			p.Dynamic = field.Value == initiationDynamic
+		case field.Tag >= "26" && field.Tag <= "51":
+			sub, err := DecodeFields(field.Value)
+			if err != nil {
+				return nil, fmt.Errorf("merchant account %s: %w", field.Tag, err)
+			}
+
+			account := MerchantAccount{Tag: field.Tag}
+			for _, s := range sub {
+				if s.Tag == "00" {
+					account.GUID = s.Value
+				} else {
+					account.Fields = append(account.Fields, s)
+				}
+			}
+			p.Accounts = append(p.Accounts, account)
+		case field.Tag == tagCategoryCode:
+			p.CategoryCode = field.Value
+		case field.Tag == tagCurrency:
+			p.Currency = field.Value
+		case field.Tag == tagAmount:
+			p.Amount = field.Value
+		case field.Tag == tagCountry:
+			p.CountryCode = field.Value
+		case field.Tag == tagName:
+			p.MerchantName = field.Value
+		case field.Tag == tagCity:
+			p.MerchantCity = field.Value
+		case field.Tag == tagPostalCode:
+			p.PostalCode = field.Value
+		case field.Tag == tagAdditional:
+			if p.Additional, err = DecodeFields(field.Value); err != nil {
+				return nil, fmt.Errorf("additional data: %w", err)
+			}
+		default:
+			p.Extra = append(p.Extra, field)
+		}
+	}
+
+	if len(p.Accounts) == 0 {
+		return nil, errors.New("payload has no merchant account")
+	}
+	if p.Dynamic && p.Amount == "" {
+		return nil, errors.New("dynamic payload has no amount")
+	}
+
+	return &p, nil
+}
+
+func get(fields []Field, tag string) string {
+	for _, field := range fields {
+		if field.Tag == tag {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+func checkLength(name, value string, min, max int) error {
+	if len(value) < min || len(value) > max {
+		if min == max {
+			return fmt.Errorf("%s must be %d characters", name, min)
+		}
+		return fmt.Errorf("%s must be %d to %d characters", name, min, max)
+	}
+	return nil
+}
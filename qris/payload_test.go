@@ -0,0 +1,126 @@
+package qris
+
+import (
+	"strings"
+	"testing"
+)
+
+func dynamicPayload() Payload {
+	return Payload{
+		Dynamic: true,
+		Accounts: []MerchantAccount{{
+			Tag:    "26",
+			GUID:   "ID.CO.EXAMPLE.WWW",
+			Fields: []Field{{Tag: "01", Value: "42"}},
+		}},
+		CategoryCode: "4829",
+		Currency:     "360",
+		Amount:       "15000",
+		CountryCode:  "ID",
+		MerchantName: "Toko Maju",
+		MerchantCity: "Jakarta",
+		Additional:   []Field{{Tag: AdditionalReference, Value: "QR0011223344556677"}},
+		Extra:        []Field{{Tag: "64", Value: "0002ID"}},
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	want := dynamicPayload()
+	encoded, err := want.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// root fields are written in tag order whatever order they were set in
+	if !strings.HasPrefix(encoded, "000201010212") || !strings.Contains(encoded, "5405150005802ID") {
+		t.Errorf("Encode = %q", encoded)
+	}
+
+	got, err := Decode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Dynamic != want.Dynamic || got.Amount != want.Amount || got.Currency != want.Currency ||
+		got.MerchantName != want.MerchantName || got.MerchantCity != want.MerchantCity ||
+		got.CategoryCode != want.CategoryCode || got.CountryCode != want.CountryCode {
+		t.Errorf("Decode = %+v, want %+v", got, want)
+	}
+
+	account, ok := got.Account("ID.CO.EXAMPLE.WWW")
+	if !ok || account.Get("01") != "42" {
+		t.Errorf("merchant account came back as %+v", got.Accounts)
+	}
+	if got.AdditionalData(AdditionalReference) != "QR0011223344556677" {
+		t.Errorf("additional data came back as %+v", got.Additional)
+	}
+	if len(got.Extra) != 1 || got.Extra[0] != want.Extra[0] {
+		t.Errorf("unknown fields came back as %+v, want them kept", got.Extra)
+	}
+
+	// a static code has no amount and can be paid with any
+	static := dynamicPayload()
+	static.Dynamic, static.Amount = false, ""
+	encoded, err = static.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Decode(encoded); err != nil || got.Dynamic || got.Amount != "" {
+		t.Errorf("static code decoded as %+v, %v", got, err)
+	}
+}
+
+func TestEncodeRejects(t *testing.T) {
+	for name, change := range map[string]func(*Payload){
+		"a dynamic code without amount": func(p *Payload) { p.Amount = "" },
+		"no merchant account":           func(p *Payload) { p.Accounts = nil },
+		"an account tag out of range":   func(p *Payload) { p.Accounts[0].Tag = "52" },
+		"a long merchant name":          func(p *Payload) { p.MerchantName = strings.Repeat("x", 26) },
+		"an accented merchant city":     func(p *Payload) { p.MerchantCity = "Bogotá" },
+		"a two digit currency":          func(p *Payload) { p.Currency = "36" },
+	} {
+		p := dynamicPayload()
+		change(&p)
+		if got, err := p.Encode(); err == nil {
+			t.Errorf("%s was encoded as %q", name, got)
+		}
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	p := dynamicPayload()
+	valid, err := p.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merchant, err := EncodeFields([]Field{{Tag: "00", Value: "ID.CO.EXAMPLE.WWW"}, {Tag: "01", Value: "42"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noAmount, err := EncodeFields([]Field{
+		{Tag: "00", Value: "01"},
+		{Tag: "01", Value: "12"},
+		{Tag: "26", Value: merchant},
+		{Tag: "53", Value: "360"},
+		{Tag: "58", Value: "ID"},
+		{Tag: "59", Value: "Toko Maju"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, payload := range map[string]string{
+		"a changed amount":              strings.Replace(valid, "5405150005802", "5405160005802", 1),
+		"a dropped CRC":                 valid[:len(valid)-8],
+		"a CRC that isn't hex":          valid[:len(valid)-4] + "ZZZZ",
+		"a missing format indicator":    appendCRC("010211"),
+		"an unknown initiation":         appendCRC("000201010213"),
+		"no merchant account":           appendCRC("000201010211"),
+		"a field longer than the rest":  appendCRC("0002010102115910Toko"),
+		"a dynamic code without amount": appendCRC(noAmount),
+	} {
+		if got, err := Decode(payload); err == nil {
+			t.Errorf("%s was decoded as %+v", name, got)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Package qris encodes and decodes EMVCo merchant-presented QR payloads as
+// used by QRIS. A payload is a string of TLV fields: a two digit tag, a two
+// digit length and the value, closed by a CRC16 checksum in tag 63.
+package qris
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Field is one TLV field. Template fields such as merchant account
+// information hold further fields in their value.
+type Field struct {
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+}
+
+// EncodeFields writes fields in order as TLV. Tags must be two digits and
+// values at most 99 characters of printable ASCII, since lengths count
+// bytes.
+func EncodeFields(fields []Field) (string, error) {
+	var b strings.Builder
+	for _, field := range fields {
+		if len(field.Tag) != 2 || !isDigits(field.Tag) {
+			return "", fmt.Errorf("invalid tag %q", field.Tag)
+		}
+		if len(field.Value) > 99 {
+			return "", fmt.Errorf("tag %s: value longer than 99 characters", field.Tag)
+		}
+		if !IsPrintableASCII(field.Value) {
+			return "", fmt.Errorf("tag %s: value is not printable ASCII", field.Tag)
+		}
+
+		fmt.Fprintf(&b, "%s%02d%s", field.Tag, len(field.Value), field.Value)
+	}
+
+	return b.String(), nil
+}
+
+// DecodeFields splits a TLV string into its fields in order.
+func DecodeFields(data string) ([]Field, error) {
+	if !IsPrintableASCII(data) {
+		return nil, errors.New("payload is not printable ASCII")
+	}
+
+	var fields []Field
+	for len(data) > 0 {
+		if len(data) < 4 || !isDigits(data[:4]) {
+			return nil, fmt.Errorf("malformed field at %q", data)
+		}
+
+		tag := data[:2]
+		length, _ := strconv.Atoi(data[2:4])
+		if len(data) < 4+length {
+			return nil, fmt.Errorf("tag %s: value shorter than its length %d", tag, length)
+		}
+
+		fields = append(fields, Field{Tag: tag, Value: data[4 : 4+length]})
+		data = data[4+length:]
+	}
+
+	return fields, nil
+}
+
+// CRC16 returns the CRC-16/CCITT-FALSE checksum (polynomial 0x1021, initial
+// value 0xFFFF) EMVCo payloads are closed with.
+func CRC16(data string) uint16 {
+	crc := uint16(0xFFFF)
+	for i := 0; i < len(data); i++ {
+		crc ^= uint16(data[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// appendCRC closes a payload with tag 63. The checksum covers everything
+// before it, including the "6304" of the tag itself.
+func appendCRC(payload string) string {
+	payload += tagCRC + "04"
+	return fmt.Sprintf("%s%04X", payload, CRC16(payload))
+}
+
+// checkCRC verifies that a payload ends with a valid tag 63.
+func checkCRC(payload string) error {
+	if len(payload) < 8 || payload[len(payload)-8:len(payload)-4] != tagCRC+"04" {
+		return errors.New("payload does not end with a CRC")
+	}
+
+	want, err := strconv.ParseUint(payload[len(payload)-4:], 16, 16)
+	if err != nil {
+		return errors.New("invalid CRC")
+	}
+	if CRC16(payload[:len(payload)-4]) != uint16(want) {
+		return errors.New("CRC does not match")
+	}
+
+	return nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// IsPrintableASCII reports whether s only holds the characters a field value
+// may use.
+func IsPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
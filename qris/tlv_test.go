@@ -0,0 +1,88 @@
+package qris
+
+import (
+	"strings"
+	"testing"
+)
+
+// The check value of CRC-16/CCITT-FALSE is 0x29B1 for "123456789".
+func TestCRC16(t *testing.T) {
+	if got := CRC16("123456789"); got != 0x29B1 {
+		t.Errorf("CRC16 check value = %04X, want 29B1", got)
+	}
+	if got := CRC16(""); got != 0xFFFF {
+		t.Errorf("CRC16 of nothing = %04X, want the initial FFFF", got)
+	}
+}
+
+func TestAppendCRCCoversItsTag(t *testing.T) {
+	payload := appendCRC("000201")
+
+	if !strings.HasPrefix(payload, "0002016304") {
+		t.Fatalf("appendCRC = %q", payload)
+	}
+	if err := checkCRC(payload); err != nil {
+		t.Errorf("checkCRC rejected its own CRC: %v", err)
+	}
+
+	// a field added after the CRC was computed must break it
+	if err := checkCRC("5904Toko" + payload); err == nil {
+		t.Error("checkCRC accepted a payload with a field put in front")
+	}
+}
+
+func TestEncodeFieldsRoundTrip(t *testing.T) {
+	fields := []Field{
+		{Tag: "00", Value: "01"},
+		{Tag: "62", Value: ""},
+		{Tag: "59", Value: strings.Repeat("x", 99)},
+	}
+
+	encoded, err := EncodeFields(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "00020162005999") {
+		t.Errorf("EncodeFields = %q", encoded)
+	}
+
+	decoded, err := DecodeFields(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(fields) {
+		t.Fatalf("DecodeFields gave %d fields, want %d", len(decoded), len(fields))
+	}
+	for n := range fields {
+		if decoded[n] != fields[n] {
+			t.Errorf("field %d came back as %+v, want %+v", n, decoded[n], fields[n])
+		}
+	}
+}
+
+func TestEncodeFieldsRejects(t *testing.T) {
+	for name, field := range map[string]Field{
+		"a one digit tag":       {Tag: "5", Value: "x"},
+		"a letter in the tag":   {Tag: "5A", Value: "x"},
+		"a hundred characters":  {Tag: "59", Value: strings.Repeat("x", 100)},
+		"an accented character": {Tag: "59", Value: "Café"},
+		"a line break":          {Tag: "59", Value: "Toko\nMaju"},
+	} {
+		if got, err := EncodeFields([]Field{field}); err == nil {
+			t.Errorf("%s was encoded as %q", name, got)
+		}
+	}
+}
+
+func TestDecodeFieldsRejects(t *testing.T) {
+	for name, data := range map[string]string{
+		"a cut off header":    "000",
+		"a length not digits": "00A1x",
+		"a short value":       "0005abc",
+		"a multibyte value":   "5905Café",
+	} {
+		if got, err := DecodeFields(data); err == nil {
+			t.Errorf("%s was decoded as %+v", name, got)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// currencyExponents lists the supported ISO 4217 currencies and how many
+// minor units they are stored in. IDR is kept in whole rupiah.
+var currencyExponents = map[string]int{
+	"AUD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"IDR": 0,
+	"JPY": 0,
+	"MYR": 2,
+	"SGD": 2,
+	"USD": 2,
+}
+
+// currencyNumeric lists the ISO 4217 numeric code of every supported
+// currency, as used in QR payloads.
+var currencyNumeric = map[string]string{
+	"AUD": "036",
+	"EUR": "978",
+	"GBP": "826",
+	"IDR": "360",
+	"JPY": "392",
+	"MYR": "458",
+	"SGD": "702",
+	"USD": "840",
+}
+
+func CurrencySupported(code string) bool {
+	_, ok := currencyExponents[code]
+	return ok
+}
+
+// ParseRate parses a positive decimal exchange rate such as "15750.25".
+// Fractions, exponents and base prefixes such as "0x" are rejected.
+func ParseRate(rate string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(rate)
+	if !ok || r.Sign() <= 0 || !isDecimal(rate) {
+		return nil, errors.New("rate must be a positive decimal number")
+	}
+	return r, nil
+}
+
+// ConvertAmount converts an amount in minor units of one currency to minor
+// units of another, where rate is the price of one major unit of from in
+// major units of to. The result is rounded down.
+func ConvertAmount(amount int64, rate *big.Rat, from, to string) int64 {
+	value := new(big.Rat).SetInt64(amount)
+	value.Mul(value, rate)
+	value.Mul(value, new(big.Rat).SetFrac(pow10(currencyExponents[to]), pow10(currencyExponents[from])))
+
+	return new(big.Int).Quo(value.Num(), value.Denom()).Int64()
+}
+
+// FormatAmount formats an amount in minor units as a decimal in major units,
+// e.g. 12345 USD as "123.45".
+func FormatAmount(amount int64, currency string) string {
+	exponent := currencyExponents[currency]
+	if exponent == 0 {
+		return fmt.Sprintf("%d", amount)
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	digits := fmt.Sprintf("%0*d", exponent+1, amount)
+	split := len(digits) - exponent
+	return sign + digits[:split] + "." + digits[split:]
+}
+
+// ParseAmount parses a positive decimal in major units, e.g. "123.45" USD,
+// into minor units. It has to be exact in the currency's minor units.
+func ParseAmount(text, currency string) (int64, error) {
+	exponent, ok := currencyExponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("unsupported currency %s", currency)
+	}
+
+	value, ok := new(big.Rat).SetString(text)
+	if !ok || value.Sign() <= 0 || !isDecimal(text) {
+		return 0, errors.New("amount must be a positive decimal number")
+	}
+
+	value.Mul(value, new(big.Rat).SetInt(pow10(exponent)))
+	if !value.IsInt() || !value.Num().IsInt64() {
+		return 0, fmt.Errorf("amount has more than %d decimals or is too large", exponent)
+	}
+	return value.Num().Int64(), nil
+}
+
+// CurrencyNumeric returns the ISO 4217 numeric code of a supported currency,
+// e.g. "360" for IDR.
+func CurrencyNumeric(code string) (string, bool) {
+	numeric, ok := currencyNumeric[code]
+	return numeric, ok
+}
+
+// CurrencyFromNumeric returns the supported currency with an ISO 4217
+// numeric code.
+func CurrencyFromNumeric(numeric string) (string, bool) {
+	for code, n := range currencyNumeric {
+		if n == numeric {
+			return code, true
+		}
+	}
+	return "", false
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// isDecimal reports whether s is written as plain digits with at most one
+// decimal point, which big.Rat alone doesn't check.
+func isDecimal(s string) bool {
+	digits, point := 0, false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+			digits++
+		case s[i] == '.' && !point:
+			point = true
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
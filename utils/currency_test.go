@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	for _, c := range []struct {
+		text, currency string
+		want           int64
+	}{
+		{"123.45", "USD", 12345},
+		{"0.01", "USD", 1},
+		{"10", "USD", 1000},
+		{"10.50", "EUR", 1050},
+		{"15000", "IDR", 15000},
+		{"15000.00", "IDR", 15000}, // trailing zeros are still exact
+		{"500", "JPY", 500},
+	} {
+		got, err := ParseAmount(c.text, c.currency)
+		if err != nil || got != c.want {
+			t.Errorf("ParseAmount(%q, %s) = %d, %v, want %d", c.text, c.currency, got, err, c.want)
+		}
+	}
+}
+
+func TestParseAmountRejects(t *testing.T) {
+	for _, c := range []struct{ text, currency, why string }{
+		{"1.5", "IDR", "IDR has no minor unit"},
+		{"1.234", "USD", "a third decimal"},
+		{"0", "USD", "nothing"},
+		{"0.00", "USD", "nothing with decimals"},
+		{"-1", "USD", "a negative amount"},
+		{"1e3", "IDR", "an exponent"},
+		{"1E3", "IDR", "an upper case exponent"},
+		{"1/2", "USD", "a fraction"},
+		{"1,000", "IDR", "a thousands separator"},
+		{"0x10", "IDR", "a hex prefix"},
+		{"+10", "IDR", "a plus sign"},
+		{"1.2.3", "USD", "two decimal points"},
+		{"", "USD", "an empty string"},
+		{"100000000000000000000", "IDR", "more than an int64"},
+		{"10", "XXX", "an unknown currency"},
+		{"10", "usd", "a lower case currency"},
+	} {
+		if got, err := ParseAmount(c.text, c.currency); err == nil {
+			t.Errorf("ParseAmount(%q, %s) = %d, want an error for %s", c.text, c.currency, got, c.why)
+		}
+	}
+}
+
+func TestCurrencyNumeric(t *testing.T) {
+	for code := range currencyExponents {
+		numeric, ok := CurrencyNumeric(code)
+		if !ok {
+			t.Errorf("%s has no numeric code", code)
+			continue
+		}
+		if back, ok := CurrencyFromNumeric(numeric); !ok || back != code {
+			t.Errorf("numeric code %s of %s maps back to %q", numeric, code, back)
+		}
+	}
+
+	if code, ok := CurrencyFromNumeric("999"); ok {
+		t.Errorf("unknown numeric code 999 maps to %s", code)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	rate, err := ParseRate("15750.25")
+	if err != nil || rate.FloatString(2) != "15750.25" {
+		t.Errorf("ParseRate(15750.25) = %v, %v", rate, err)
+	}
+
+	for _, text := range []string{"0", "-1", "1/3", "1e4", "1E4", "0x10", "", "fast"} {
+		if rate, err := ParseRate(text); err == nil {
+			t.Errorf("ParseRate(%q) = %s, want an error", text, rate.RatString())
+		}
+	}
+}
+
+func TestConvertAmount(t *testing.T) {
+	rate := func(text string) *big.Rat {
+		r, err := ParseRate(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	for _, c := range []struct {
+		amount   int64
+		from, to string
+		rate     *big.Rat
+		want     int64
+	}{
+		// 10.00 USD is 157502.5 rupiah, the half rupiah is dropped
+		{1000, "USD", "IDR", rate("15750.25"), 157502},
+		// 100000 rupiah is 6.34 USD
+		{100000, "IDR", "USD", rate("0.0000634"), 634},
+		// under a cent comes to nothing
+		{100, "IDR", "USD", rate("0.0000634"), 0},
+		// one cent is 1.515 yen, yen have no minor unit
+		{1, "USD", "JPY", rate("151.5"), 1},
+	} {
+		if got := ConvertAmount(c.amount, c.rate, c.from, c.to); got != c.want {
+			t.Errorf("ConvertAmount(%d %s to %s) = %d, want %d", c.amount, c.from, c.to, got, c.want)
+		}
+	}
+}